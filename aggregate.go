@@ -0,0 +1,106 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AggResult summarises a numeric field over a collection. Count is the
+// number of records whose field held a number, and Min, Max, Sum and Avg
+// are computed over those; they are zero when Count is. Skipped counts the
+// records that lacked the field or held something else there.
+type AggResult struct {
+	Count   int
+	Skipped int
+	Min     float64
+	Max     float64
+	Sum     float64
+	Avg     float64
+}
+
+func (a *AggResult) add(v interface{}, ok bool) {
+	n, isNumber := v.(json.Number)
+	if !ok || !isNumber {
+		a.Skipped++
+		return
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		a.Skipped++
+		return
+	}
+
+	if a.Count == 0 || f < a.Min {
+		a.Min = f
+	}
+	if a.Count == 0 || f > a.Max {
+		a.Max = f
+	}
+
+	a.Count++
+	a.Sum += f
+	a.Avg = a.Sum / float64(a.Count)
+}
+
+// Aggregate computes the minimum, maximum, sum and average of the numeric
+// field over every record of collection; a dotted name such as
+// "address.zip" selects a nested field, as in Project. Records are streamed
+// as in ForEach, so memory use doesn't grow with the collection.
+func (d *Driver) Aggregate(collection, field string) (AggResult, error) {
+	var result AggResult
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			return fmt.Errorf("Unable to aggregate '%s': %v", resource, err)
+		}
+
+		result.add(lookupField(doc, field))
+		return nil
+	})
+	if err != nil {
+		return AggResult{}, err
+	}
+
+	return result, nil
+}
+
+// GroupBy is Aggregate per group: records are grouped by the value of
+// groupField and valueField is aggregated within each group. Both fields
+// may be dotted paths. Numbers and booleans group by their JSON text, so
+// 30 and "30" share a group. Records whose groupField is missing, null, an
+// object or an array are gathered under the empty-string key, where their
+// values still count.
+func (d *Driver) GroupBy(collection, groupField, valueField string) (map[string]AggResult, error) {
+	groups := make(map[string]AggResult)
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			return fmt.Errorf("Unable to aggregate '%s': %v", resource, err)
+		}
+
+		var key string
+		if v, ok := lookupField(doc, groupField); ok {
+			switch g := v.(type) {
+			case string:
+				key = g
+			case json.Number:
+				key = g.String()
+			case bool:
+				key = fmt.Sprint(g)
+			}
+		}
+
+		result := groups[key]
+		result.add(lookupField(doc, valueField))
+		groups[key] = result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,211 @@
+package godb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// WriteAsync trades durability for throughput: it returns as soon as the
+// write is queued in memory, and a crash or a process exit without Close
+// loses whatever is still queued - acknowledged writes included. Each of
+// Options.AsyncWorkers goroutines owns a queue of its share of
+// Options.AsyncQueueSize, and every write of a record goes to the same
+// one, so queued writes of a record land in the order they were made.
+// They aren't ordered against Write and the other synchronous methods,
+// though: Flush before mixing the two on a record.
+//
+// The queues and goroutines start with the first WriteAsync.
+
+// DefaultAsyncQueueSize and DefaultAsyncWorkers are the defaults of
+// Options.AsyncQueueSize and Options.AsyncWorkers.
+const (
+	DefaultAsyncQueueSize = 1024
+	DefaultAsyncWorkers   = 4
+)
+
+type asyncWrite struct {
+	collection string
+	resource   string
+	b          []byte
+}
+
+type asyncQueue struct {
+	// mu is held for reading while a write is queued and for writing by
+	// close, so no write is queued after the queues are closed.
+	mu      sync.RWMutex
+	closed  bool
+	queues  []chan asyncWrite
+	workers sync.WaitGroup
+
+	pendingMu sync.Mutex
+	drained   *sync.Cond
+	pending   int
+	err       error
+}
+
+func checkAsync(opts *Options) error {
+	if opts.AsyncQueueSize < 0 || opts.AsyncWorkers < 0 {
+		return fmt.Errorf("Invalid async writes - queue size and workers can't be negative!")
+	}
+
+	if opts.AsyncQueueSize == 0 {
+		opts.AsyncQueueSize = DefaultAsyncQueueSize
+	}
+
+	if opts.AsyncWorkers == 0 {
+		opts.AsyncWorkers = DefaultAsyncWorkers
+	}
+
+	return nil
+}
+
+// asyncQueue returns the driver's queue, starting it on first use.
+func (d *Driver) asyncQueue() *asyncQueue {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.async != nil {
+		return d.async
+	}
+
+	workers := d.opts.AsyncWorkers
+	size := d.opts.AsyncQueueSize / workers
+	if size < 1 {
+		size = 1
+	}
+
+	q := &asyncQueue{queues: make([]chan asyncWrite, workers)}
+	q.drained = sync.NewCond(&q.pendingMu)
+
+	for i := range q.queues {
+		q.queues[i] = make(chan asyncWrite, size)
+		q.workers.Add(1)
+		go d.storeAsync(q, q.queues[i])
+	}
+
+	d.async = q
+	return q
+}
+
+func (d *Driver) storeAsync(q *asyncQueue, queue chan asyncWrite) {
+	defer q.workers.Done()
+
+	for w := range queue {
+		err := d.writeAsync(w)
+		if err != nil {
+			if d.opts.OnAsyncError != nil {
+				d.opts.OnAsyncError(w.collection, w.resource, err)
+			} else {
+				d.logKV(LevelError, "async write failed", "op", OpWrite, "collection", w.collection, "resource", w.resource, "error", err)
+			}
+		}
+
+		q.pendingMu.Lock()
+		if err != nil && q.err == nil {
+			q.err = fmt.Errorf("Unable to write '%s' in '%s' - %w", w.resource, w.collection, err)
+		}
+		q.pending--
+		if q.pending == 0 {
+			q.drained.Broadcast()
+		}
+		q.pendingMu.Unlock()
+	}
+}
+
+func (d *Driver) writeAsync(w asyncWrite) error {
+	unlock := d.lockResource(w.collection, w.resource)
+	defer unlock()
+
+	b, err := d.prepare(w.collection, w.resource, w.b)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.writeEncoded(w.collection, w.resource, b)
+	return err
+}
+
+// WriteAsync queues a write of v to resource in collection and returns
+// without waiting for it, blocking only while the record's queue is full.
+// Names and authorization are checked, and v is marshaled, before it
+// returns, so v may be reused at once; everything else Write does happens
+// later, with failures going to Options.OnAsyncError and the next Flush.
+// See the top of asyncwrite.go for what can be lost. After Close it fails
+// with ErrClosed.
+func (d *Driver) WriteAsync(collection, resource string, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	b, err := d.opts.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	q := d.asyncQueue()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(d.recordKey(collection, resource)))
+
+	q.pendingMu.Lock()
+	q.pending++
+	q.pendingMu.Unlock()
+
+	q.queues[h.Sum32()%uint32(len(q.queues))] <- asyncWrite{collection, resource, b}
+	return nil
+}
+
+// Flush waits until every write queued by WriteAsync so far has been
+// stored or has failed, and returns the first failure since the last
+// Flush, if any.
+func (d *Driver) Flush() error {
+	d.mutex.Lock()
+	q := d.async
+	d.mutex.Unlock()
+
+	if q == nil {
+		return nil
+	}
+
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	for q.pending > 0 {
+		q.drained.Wait()
+	}
+
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// closeAsync drains and stops the queue for Close, and keeps WriteAsync
+// from starting a new one.
+func (d *Driver) closeAsync() {
+	d.mutex.Lock()
+	q := d.async
+	if q == nil {
+		q = &asyncQueue{}
+		d.async = q
+	}
+	d.mutex.Unlock()
+
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, queue := range q.queues {
+			close(queue)
+		}
+	}
+	q.mu.Unlock()
+
+	q.workers.Wait()
+}
@@ -0,0 +1,504 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Swap exchanges the contents of two records in a collection. Under the
+// collection lock it renames resourceB aside to "<resourceB>.json.swap",
+// renames resourceA onto resourceB, then renames the set-aside file onto
+// resourceA. An observer may briefly find one of the two names missing, but
+// never sees both records holding the same content. Names that are the same
+// under Options.CaseInsensitiveKeys swap nothing. The mirror, if any, gets
+// both records written anew.
+func (d *Driver) Swap(collection, resourceA, resourceB string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to swap records!")
+	}
+
+	if resourceA == "" || resourceB == "" {
+		return fmt.Errorf("Missing resource - unable to swap records (no name)!")
+	}
+
+	if err := d.validateNames(collection, resourceA, resourceB); err != nil {
+		return err
+	}
+
+	for _, resource := range []string{resourceA, resourceB} {
+		if err := d.authorize(OperationWrite, collection, resource); err != nil {
+			return err
+		}
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	if err := d.FenceCheck(); err != nil {
+		return err
+	}
+
+	pathA := d.recordPath(collection, resourceA)
+	pathB := d.recordPath(collection, resourceB)
+	if d.opts.Exploded {
+		pathA = d.explodedDir(collection, resourceA)
+		pathB = d.explodedDir(collection, resourceB)
+	}
+
+	for _, path := range []string{pathA, pathB} {
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+
+	if d.foldKey(resourceA) == d.foldKey(resourceB) {
+		return nil
+	}
+
+	swapPath := pathB + ".swap"
+
+	if err := os.Rename(pathB, swapPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(pathA, pathB); err != nil {
+		os.Rename(swapPath, pathB)
+		return err
+	}
+
+	if err := os.Rename(swapPath, pathA); err != nil {
+		return err
+	}
+
+	swapped := []string{resourceA, resourceB}
+	for _, resource := range swapped {
+		if d.opts.OnConflict != nil {
+			d.noteVersion(collection, resource)
+		}
+
+		d.cache.remove(collection, resource)
+		if b, err := d.readRecord(collection, resource); err == nil {
+			d.reindex(collection, resource, b)
+		} else {
+			d.reindex(collection, resource, nil)
+		}
+	}
+	d.trace(OpSwap, collection, resourceA, 0)
+	d.trace(OpSwap, collection, resourceB, 0)
+	d.logKV(LevelInfo, "swapped records", "op", OpSwap, "collection", collection, "resource", resourceA, "with", resourceB)
+
+	// The mirror gets both records written afresh.
+	return d.mirrorOp("swap", collection, resourceA, func(m *Driver) error {
+		for _, resource := range swapped {
+			b, err := d.readRecord(collection, resource)
+			if err != nil {
+				return err
+			}
+			if err := m.writeRecord(collection, resource, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteIf writes v only if cond, called under the collection lock with the
+// record's current contents, returns true; otherwise it returns
+// ErrConditionFailed. exists is false (and current nil) for a missing
+// record, which makes WriteIf usable for create-if-absent as well as
+// compare-and-set on any field.
+func (d *Driver) WriteIf(collection, resource string, v interface{}, cond func(current []byte, exists bool) (bool, error)) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	current, err := d.readRecord(collection, resource)
+	exists := err == nil
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	ok, err := cond(current, exists)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrConditionFailed
+	}
+
+	return d.write(collection, resource, v)
+}
+
+// WriteIfAbsent writes v only if the record doesn't exist yet and reports
+// whether it did; an existing record is left untouched and is not an error.
+// The existence check and the write happen under the same lock.
+func (d *Driver) WriteIfAbsent(collection, resource string, v interface{}) (bool, error) {
+	err := d.WriteIf(collection, resource, v, func(current []byte, exists bool) (bool, error) {
+		return !exists, nil
+	})
+	if err == ErrConditionFailed {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReplaceCollection swaps in a new set of records for collection. The
+// records are first written to a hidden sibling directory; then, under the
+// collection lock, the live directory is renamed aside, the new one renamed
+// into its place and the old one removed. Renaming a directory over an
+// existing one isn't portable (POSIX requires it to be empty, Windows
+// refuses), which is why the old directory is moved aside first; readers
+// can find the collection missing only between those two renames. The
+// collection's config file is carried over.
+func (d *Driver) ReplaceCollection(collection string, records map[string]interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - nothing to replace!")
+	}
+
+	for resource := range records {
+		if err := d.checkWrite(collection, resource); err != nil {
+			return err
+		}
+	}
+
+	dir := d.collectionDir(collection)
+	staging := filepath.Join(filepath.Dir(dir), "."+filepath.Base(dir)+".replace")
+	old := filepath.Join(filepath.Dir(dir), "."+filepath.Base(dir)+".old")
+
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	total := 0
+
+	for resource, v := range records {
+		b, err := d.encode(collection, resource, v)
+		if err != nil {
+			return fmt.Errorf("Unable to encode '%s': %w", resource, err)
+		}
+
+		rel, err := filepath.Rel(dir, d.recordPath(collection, resource))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("Unable to replace collection '%s' - its records don't live in its directory!", collection)
+		}
+
+		record := b
+		if d.opts.UseEnvelope {
+			if record, err = d.wrap(d.newMeta(), b); err != nil {
+				return err
+			}
+		}
+
+		stored, err := d.seal(collection, resource, record)
+		if err != nil {
+			return err
+		}
+
+		if err := d.writeFileAtomic(filepath.Join(staging, rel), stored); err != nil {
+			return err
+		}
+		total += len(b)
+	}
+
+	if err := d.mkdirAll(staging); err != nil {
+		return err
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, configFile)); err == nil {
+		if err := d.writeFileAtomic(filepath.Join(staging, configFile), b); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		os.Rename(old, dir)
+		return err
+	}
+
+	d.cache.remove(collection, "")
+	d.forgetUsage(collection)
+	d.forgetIndexes(collection)
+	d.trace(OpReplace, collection, "", total)
+
+	return os.RemoveAll(old)
+}
+
+// Rotate archives collection under archiveName and starts it afresh: under
+// both collections' locks, the collection directory is renamed to the
+// archive's and an empty directory, with a copy of the collection's config
+// file, is created in its place. It fails if archiveName already exists, and
+// with ErrNotFound if collection does not.
+func (d *Driver) Rotate(collection, archiveName string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - nothing to rotate!")
+	}
+
+	if archiveName == "" {
+		return fmt.Errorf("Missing archive - no place to rotate collection '%s' to!", collection)
+	}
+
+	if err := d.validateNames(collection, archiveName); err != nil {
+		return err
+	}
+
+	if collection == archiveName {
+		return fmt.Errorf("Unable to rotate collection '%s' onto itself!", collection)
+	}
+
+	for _, c := range []string{collection, archiveName} {
+		if err := d.authorize(OperationWrite, c, ""); err != nil {
+			return err
+		}
+	}
+
+	// Lock in name order so concurrent rotations can't deadlock.
+	first, second := collection, archiveName
+	if second < first {
+		first, second = second, first
+	}
+
+	unlockFirst := d.lockCollection(first)
+	defer unlockFirst()
+
+	unlockSecond := d.lockCollection(second)
+	defer unlockSecond()
+
+	dir := d.collectionDir(collection)
+	archive := d.collectionDir(archiveName)
+
+	if _, err := os.Stat(archive); err == nil {
+		return fmt.Errorf("Unable to rotate collection '%s' - '%s' already exists!", collection, archiveName)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if err := d.mkdirAll(filepath.Dir(archive)); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dir, archive); err != nil {
+		return err
+	}
+
+	if err := d.mkdirAll(dir); err != nil {
+		return err
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(archive, configFile)); err == nil {
+		if err := d.writeFileAtomic(filepath.Join(dir, configFile), b); err != nil {
+			return err
+		}
+	}
+
+	d.mutex.Lock()
+	delete(d.configs, archiveName)
+	d.mutex.Unlock()
+
+	d.cache.remove(collection, "")
+	d.cache.remove(archiveName, "")
+	for _, c := range []string{collection, archiveName} {
+		d.forgetUsage(c)
+		d.forgetIndexes(c)
+	}
+	d.trace(OpRotate, collection, "", 0)
+	d.logKV(LevelInfo, "rotated collection", "op", OpRotate, "collection", collection, "archive", archiveName)
+	return nil
+}
+
+// RenameCollection renames the collection oldName to newName with a
+// single rename of its directory, under both collections' locks, so its
+// config, schema, staged records and leases move with its records. It
+// fails with ErrCollectionExists if newName already exists, and with
+// ErrCollectionNotFound if oldName does not.
+func (d *Driver) RenameCollection(oldName, newName string) error {
+	if oldName == "" || newName == "" {
+		return fmt.Errorf("Missing collection - unable to rename (no old or new name)!")
+	}
+
+	if err := d.validateNames(oldName, newName); err != nil {
+		return err
+	}
+
+	if oldName == newName {
+		return fmt.Errorf("Unable to rename collection '%s' onto itself!", oldName)
+	}
+
+	for _, check := range []struct {
+		op         Operation
+		collection string
+	}{{OperationDelete, oldName}, {OperationWrite, newName}} {
+		if err := d.authorize(check.op, check.collection, ""); err != nil {
+			return err
+		}
+	}
+
+	// Lock in name order so concurrent renames can't deadlock.
+	first, second := oldName, newName
+	if second < first {
+		first, second = second, first
+	}
+
+	unlockFirst := d.lockCollection(first)
+	defer unlockFirst()
+
+	unlockSecond := d.lockCollection(second)
+	defer unlockSecond()
+
+	return d.renameCollection(oldName, newName)
+}
+
+// renameCollection is RenameCollection without the checks and locks.
+func (d *Driver) renameCollection(oldName, newName string) error {
+	if err := d.FenceCheck(); err != nil {
+		return err
+	}
+
+	dir := d.collectionDir(oldName)
+	renamed := d.collectionDir(newName)
+
+	if _, err := os.Stat(renamed); err == nil {
+		return fmt.Errorf("Unable to rename collection '%s' to '%s' - %w", oldName, newName, ErrCollectionExists)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if fi, err := os.Stat(dir); os.IsNotExist(err) || err == nil && !fi.IsDir() {
+		return fmt.Errorf("Unable to rename collection '%s' - %w", oldName, ErrCollectionNotFound)
+	} else if err != nil {
+		return err
+	}
+
+	err := d.io(func() error {
+		if err := d.mkdirAll(filepath.Dir(renamed)); err != nil {
+			return err
+		}
+		return os.Rename(dir, renamed)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	delete(d.configs, oldName)
+	delete(d.configs, newName)
+	d.mutex.Unlock()
+
+	d.cache.remove(oldName, "")
+	d.cache.remove(newName, "")
+	for _, c := range []string{oldName, newName} {
+		d.forgetUsage(c)
+		d.forgetIndexes(c)
+	}
+	d.trace(OpRename, oldName, "", 0)
+	d.trace(OpRename, newName, "", 0)
+	d.logKV(LevelInfo, "renamed collection", "op", OpRename, "collection", oldName, "to", newName)
+
+	return d.mirrorOp("rename", oldName, "", func(m *Driver) error {
+		return m.renameCollection(oldName, newName)
+	})
+}
+
+// Promote moves a record to a new name, passing its contents through
+// transform on the way, e.g. to publish a draft: under the collection lock
+// it reads srcResource, writes transform's result to dstResource as Write
+// would, then deletes srcResource. If the delete fails, dstResource is put
+// back as it was, so either both steps happen or neither does. A nil
+// transform moves the record unchanged.
+func (d *Driver) Promote(collection, srcResource, dstResource string, transform func([]byte) ([]byte, error)) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to promote record!")
+	}
+
+	if srcResource == "" || dstResource == "" {
+		return fmt.Errorf("Missing resource - unable to promote record (no name)!")
+	}
+
+	if srcResource == dstResource {
+		return fmt.Errorf("Unable to promote '%s' onto itself!", srcResource)
+	}
+
+	if err := d.validateNames(collection, srcResource, dstResource); err != nil {
+		return err
+	}
+
+	for _, check := range []struct {
+		op       Operation
+		resource string
+	}{{OperationRead, srcResource}, {OperationDelete, srcResource}, {OperationWrite, dstResource}} {
+		if err := d.authorize(check.op, collection, check.resource); err != nil {
+			return err
+		}
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	b, err := d.readRecord(collection, srcResource)
+	if err != nil {
+		return err
+	}
+
+	if transform != nil {
+		if b, err = transform(b); err != nil {
+			return fmt.Errorf("Unable to transform '%s': %w", srcResource, err)
+		}
+
+		if !json.Valid(b) {
+			return fmt.Errorf("Unable to transform '%s': result is not valid JSON", srcResource)
+		}
+	}
+
+	previous, err := d.readRecord(collection, dstResource)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	if err := d.write(collection, dstResource, json.RawMessage(b)); err != nil {
+		return err
+	}
+
+	if err := d.delete(collection, srcResource); err != nil {
+		if previous != nil {
+			d.writeRecord(collection, dstResource, previous)
+		} else {
+			d.delete(collection, dstResource)
+		}
+		return err
+	}
+
+	return nil
+}
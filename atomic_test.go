@@ -0,0 +1,72 @@
+package godb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSwapSameNameUnderCaseFolding(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{CaseInsensitiveKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "Alice", map[string]string{"name": "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Swap("users", "Alice", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+	if err := db.Read("users", "alice", &got); err != nil || got["name"] != "Alice" {
+		t.Fatalf("Read after swapping a record with itself = %v, %v", got, err)
+	}
+}
+
+func TestSwapIsFencedAndMirrored(t *testing.T) {
+	dir := t.TempDir()
+	mirror := filepath.Join(t.TempDir(), "mirror")
+
+	db, err := New(dir, &Options{Fencing: true, MirrorDir: mirror, CacheSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if err := db.Write("users", name, map[string]string{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]string
+		if err := db.Read("users", name, &got); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Swap("users", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(mirror, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []struct {
+		driver *Driver
+		name   string
+		want   string
+	}{{db, "a", "b"}, {db, "b", "a"}, {m, "a", "b"}, {m, "b", "a"}} {
+		var got map[string]string
+		if err := check.driver.Read("users", check.name, &got); err != nil || got["name"] != check.want {
+			t.Fatalf("Read %s after Swap = %v, %v, want name %s", check.name, got, err, check.want)
+		}
+	}
+
+	if _, err := New(dir, &Options{Fencing: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Swap("users", "a", "b"); !errors.Is(err, ErrFenced) {
+		t.Fatalf("Swap by a fenced driver = %v, want ErrFenced", err)
+	}
+}
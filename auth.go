@@ -0,0 +1,51 @@
+package godb
+
+// Operation classifies a call for Options.Authorize.
+type Operation int
+
+const (
+	OperationRead Operation = iota
+	OperationWrite
+	OperationDelete
+	OperationList
+)
+
+func (op Operation) String() string {
+	switch op {
+	case OperationRead:
+		return "read"
+	case OperationWrite:
+		return "write"
+	case OperationDelete:
+		return "delete"
+	case OperationList:
+		return "list"
+	}
+	return "unknown"
+}
+
+// authError marks an error from Options.Authorize as ErrUnauthorized,
+// keeping its message and the error itself reachable through errors.Is and
+// errors.As.
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string { return e.err.Error() }
+
+func (e *authError) Unwrap() error { return e.err }
+
+func (e *authError) Is(target error) bool { return target == ErrUnauthorized }
+
+// authorize asks Options.Authorize whether op may proceed. resource is
+// empty for operations on a whole collection.
+func (d *Driver) authorize(op Operation, collection, resource string) error {
+	if d.opts.Authorize == nil {
+		return nil
+	}
+
+	if err := d.opts.Authorize(op, collection, resource); err != nil {
+		return &authError{err}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package godb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadFreshAuthorizesFirst(t *testing.T) {
+	refuse := errors.New("no access")
+	calls := 0
+	allowed := true
+
+	db, err := New(t.TempDir(), &Options{
+		Authorize: func(op Operation, collection, resource string) error {
+			if op != OperationRead {
+				return nil
+			}
+			calls++
+			if !allowed {
+				return refuse
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+	if err := db.ReadFresh("users", "kamo", &got, time.Hour); err != nil || got["name"] != "Kamo" {
+		t.Fatalf("ReadFresh = %v, %v", got, err)
+	}
+	if calls != 1 {
+		t.Fatalf("ReadFresh authorized %d times, want once", calls)
+	}
+
+	allowed = false
+	for _, name := range []string{"kamo", "ghost"} {
+		err := db.ReadFresh("users", name, &got, -time.Hour)
+		if !errors.Is(err, refuse) || !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("refused ReadFresh of %s = %v, want the Authorize error", name, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package godb
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// BackupSnapshot copies the database the way Snapshot copies a collection:
+// it takes every collection's lock, in name order, hard links all their
+// files into a hidden directory under the database root, and releases the
+// locks, which writers wait out for only as long as the linking takes. The
+// archive is then written from the links with no lock held, so a slow w
+// doesn't hold up writes, and the links are removed at the end.
+//
+// The hard links need a file system that supports them. Where linking
+// fails, and under the InPlace and Append write strategies, records are
+// copied instead, still under the locks - the backup is as consistent, but
+// writes wait for the copy. Either way the links or copies need the
+// database root to be writable, and the copies need room for the data.
+
+// BackupSnapshot writes a tar archive of every collection to w, holding
+// the collection locks only while a snapshot is taken, as described at the
+// top of backup.go. Entries are named by their paths under the database
+// root; hidden files such as leases and temp files are left out, as in
+// Snapshot, and so are the files at the root itself. The archive reflects
+// one point in time across all collections.
+func (d *Driver) BackupSnapshot(w io.Writer) error {
+	collections, err := d.collections()
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		if err := d.authorize(OperationList, collection, ""); err != nil {
+			return err
+		}
+	}
+
+	dir, err := ioutil.TempDir(d.dir, ".backup-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := d.linkCollections(collections, dir); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(tw, f)
+		d.countRead(int(n))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// linkCollections links the files of every collection into dir under the
+// locks of them all.
+func (d *Driver) linkCollections(collections []string, dir string) error {
+	sorted := append([]string(nil), collections...)
+	sort.Strings(sorted)
+
+	for _, collection := range sorted {
+		unlock := d.lockCollection(collection)
+		defer unlock()
+	}
+
+	return d.io(func() error {
+		for _, collection := range sorted {
+			src := d.collectionDir(collection)
+
+			rel, err := filepath.Rel(d.dir, src)
+			if err != nil {
+				return err
+			}
+
+			err = d.linkTree(src, filepath.Join(dir, rel), d.opts.WriteStrategy != AtomicRename)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+}
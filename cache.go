@@ -0,0 +1,168 @@
+package godb
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// recordCache is an LRU cache of raw record bytes. It only ever hands out
+// copies, and Read decodes a fresh value from them on every call, so callers
+// can freely mutate whatever they get back without affecting later reads.
+//
+// The cache only sees writes made through this driver; changes made by
+// other processes or directly on disk are not noticed until the entry is
+// evicted or overwritten.
+type recordCache struct {
+	mu      sync.Mutex
+	size    int
+	gen     uint64
+	order   *list.List
+	entries map[string]*list.Element
+
+	// foldKeys is Options.CaseInsensitiveKeys.
+	foldKeys bool
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+func newRecordCache(size int, foldKeys bool) *recordCache {
+	return &recordCache{
+		size:     size,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		foldKeys: foldKeys,
+	}
+}
+
+func cacheKey(collection, resource string) string {
+	return collection + "/" + resource
+}
+
+func (c *recordCache) key(collection, resource string) string {
+	if c.foldKeys {
+		resource = strings.ToLower(resource)
+	}
+	return cacheKey(collection, resource)
+}
+
+func (c *recordCache) get(collection, resource string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[c.key(collection, resource)]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+	return append([]byte(nil), e.Value.(*cacheEntry).data...), true
+}
+
+// generation returns a token to pass to fill after reading a record from
+// disk on a cache miss.
+func (c *recordCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// fill caches data read from disk, unless a write or delete happened since
+// gen was taken - the read may have raced with it and seen stale content.
+func (c *recordCache) fill(collection, resource string, data []byte, gen uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen == gen {
+		c.store(c.key(collection, resource), data)
+	}
+}
+
+// put caches data just written by the driver.
+func (c *recordCache) put(collection, resource string, data []byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.store(c.key(collection, resource), data)
+}
+
+func (c *recordCache) store(key string, data []byte) {
+	data = append([]byte(nil), data...)
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, data})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// remove drops a record, or every record of the collection when resource
+// is empty.
+func (c *recordCache) remove(collection, resource string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	if resource != "" {
+		if e, ok := c.entries[c.key(collection, resource)]; ok {
+			c.order.Remove(e)
+			delete(c.entries, e.Value.(*cacheEntry).key)
+		}
+		return
+	}
+
+	prefix := cacheKey(collection, "")
+	for key, e := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.order.Remove(e)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// clear drops every entry.
+func (c *recordCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
@@ -0,0 +1,110 @@
+package godb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCacheHandsOutCopies(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{CacheSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, ok := db.cache.get("users", "kamo")
+	if !ok {
+		t.Fatal("written record isn't cached")
+	}
+	want := string(b)
+	for i := range b {
+		b[i] = 'x'
+	}
+
+	again, _ := db.cache.get("users", "kamo")
+	if string(again) != want {
+		t.Fatalf("cached record changed through a returned slice: %q", again)
+	}
+
+	var user map[string]string
+	if err := db.Read("users", "kamo", &user); err != nil {
+		t.Fatal(err)
+	}
+	user["name"] = "changed"
+
+	user = nil
+	if err := db.Read("users", "kamo", &user); err != nil {
+		t.Fatal(err)
+	}
+	if user["name"] != "Kamo" {
+		t.Fatalf("Read after mutating an earlier result = %v", user)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newRecordCache(2, false)
+
+	c.put("users", "a", []byte("a"))
+	c.put("users", "b", []byte("b"))
+	c.get("users", "a")
+	c.put("users", "c", []byte("c"))
+
+	if _, ok := c.get("users", "b"); ok {
+		t.Error("least recently used entry survived going over capacity")
+	}
+	for _, r := range []string{"a", "c"} {
+		if _, ok := c.get("users", r); !ok {
+			t.Errorf("entry %q evicted", r)
+		}
+	}
+	if n := c.order.Len(); n != 2 {
+		t.Errorf("cache holds %d entries, capacity is 2", n)
+	}
+}
+
+func TestCacheInvalidatedByWriteAndDelete(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{CacheSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var user map[string]string
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Read("users", "kamo", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamogelo"}); err != nil {
+		t.Fatal(err)
+	}
+	user = nil
+	if err := db.Read("users", "kamo", &user); err != nil {
+		t.Fatal(err)
+	}
+	if user["name"] != "Kamogelo" {
+		t.Fatalf("Read after Write = %v, want the new record", user)
+	}
+
+	if err := db.Delete("users", "kamo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.cache.get("users", "kamo"); ok {
+		t.Fatal("deleted record still cached")
+	}
+	if err := db.Read("users", "kamo", &user); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read after Delete = %v, want ErrNotFound", err)
+	}
+
+	// A read that raced with a write mustn't cache what it saw.
+	gen := db.cache.generation()
+	db.cache.put("users", "el", []byte(`{"name":"El"}`))
+	db.cache.fill("users", "el", []byte(`{"name":"stale"}`), gen)
+	if b, _ := db.cache.get("users", "el"); string(b) != `{"name":"El"}` {
+		t.Fatalf("stale fill replaced a newer write: %s", b)
+	}
+}
@@ -0,0 +1,47 @@
+package godb
+
+import "fmt"
+
+// WriteCAS stores v content-addressed: under the checksum (hex SHA-256) of
+// its encoding with Options.Codec, which it returns. Writing the same
+// content again finds the record already there and leaves it alone, so
+// identical values are stored once. Records written this way are meant to
+// be immutable - to change one, write the new content, which lands under a
+// new name, and drop the old name once nothing refers to it.
+func (d *Driver) WriteCAS(collection string, v interface{}) (string, error) {
+	b, err := d.opts.Codec.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	hash := checksum(b)
+
+	if _, err := d.WriteIfAbsent(collection, hash, v); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// ReadCAS reads the record WriteCAS stored under hash into v.
+func (d *Driver) ReadCAS(collection, hash string, v interface{}) error {
+	if !isChecksum(hash) {
+		return fmt.Errorf("%w %q - not a content hash", ErrInvalidName, hash)
+	}
+
+	return d.Read(collection, hash, v)
+}
+
+func isChecksum(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,237 @@
+package godb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ChangeLog is built from the operations log when Options.TraceOps is set.
+// The log is appended to under a single mutex after each change has landed,
+// so its line order is the order changes were made in this process, and a
+// Change's Seq is its entry's line number: deterministic, and increasing
+// even if Clock steps back. Record contents aren't in the log, so changes
+// carry each record's current content, and only the last change of every
+// record since the timestamp is kept - replaying them brings a copy to the
+// current state, not through every state in between. An operation
+// replacing the whole collection (ReplaceCollection, Rotate,
+// RenameCollection to or from it, deleting the collection) becomes a
+// Change deleting the collection, followed by writes of the records it
+// left that weren't changed again since.
+//
+// Without TraceOps the changes are taken from record mod times, as in
+// ReadModifiedSince: a write per record modified after the timestamp,
+// ordered by mod time and then by name, with a zero Seq. Deletions can't
+// be seen this way.
+//
+// Entries aren't synced to disk, so a crash can lose the last changes
+// before it, and ChangeLog then misses them until the record changes again;
+// an entry is never logged for a change that didn't happen. Changes made
+// by other processes, or while TraceOps was off, aren't logged either.
+
+// Change is one entry of a ChangeLog.
+type Change struct {
+	Seq        int64
+	Time       time.Time
+	Op         string
+	Collection string
+
+	// Resource is empty when Op is OpDelete for the whole collection, and
+	// Data holds the record's raw content for OpWrite.
+	Resource string
+	Data     []byte
+}
+
+// ChangeLog returns the changes made to collection after since, in the
+// order they were made, for Replay against another driver. See the top of
+// changelog.go for how they are ordered and what can be missing.
+func (d *Driver) ChangeLog(collection string, since time.Time) ([]Change, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read changes!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	if !d.opts.TraceOps {
+		return d.modifiedChanges(collection, since)
+	}
+
+	records, err := d.OpsLog()
+	if err != nil {
+		return nil, err
+	}
+
+	// last holds the last entry of every record changed after since, and
+	// reset the last entry replacing the whole collection.
+	last := make(map[string]Change)
+	var reset *Change
+
+	for i, rec := range records {
+		if rec.Collection != collection || !rec.Time.After(since) {
+			continue
+		}
+
+		c := Change{Seq: int64(i + 1), Time: rec.Time, Op: rec.Op, Collection: collection}
+
+		switch {
+		case rec.Op == OpReplace || rec.Op == OpRotate || rec.Op == OpRename || rec.Op == OpDelete && rec.Resource == "":
+			c.Op = OpDelete
+			reset = &c
+			last = make(map[string]Change)
+		case rec.Op == OpWrite || rec.Op == OpDelete || rec.Op == OpSwap:
+			c.Resource = rec.Resource
+			last[rec.Resource] = c
+		}
+	}
+
+	compare := d.keyComparator(collection)
+
+	var changes []Change
+	if reset != nil {
+		changes = append(changes, *reset)
+
+		files, err := d.snapshotFiles(collection)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, file := range files {
+			name := d.resourceName(file.Name())
+			if _, ok := last[name]; !ok {
+				changes = append(changes, Change{Seq: reset.Seq, Time: reset.Time, Op: OpWrite, Collection: collection, Resource: name})
+			}
+		}
+	}
+
+	for _, c := range last {
+		changes = append(changes, c)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Seq != b.Seq {
+			return a.Seq < b.Seq
+		}
+		// A swap logs both records at once, and the collection's own
+		// delete comes before the writes sharing its entry.
+		if a.Resource == "" || b.Resource == "" {
+			return a.Resource == ""
+		}
+		return compare(a.Resource, b.Resource) < 0
+	})
+
+	for i := range changes {
+		if err := d.fillChange(&changes[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// fillChange sets a record change to write the record's current content,
+// or to delete it if it's gone.
+func (d *Driver) fillChange(c *Change) error {
+	if c.Resource == "" {
+		return nil
+	}
+
+	b, err := d.readRecord(c.Collection, c.Resource)
+	if err == ErrNotFound {
+		c.Op, c.Data = OpDelete, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Op, c.Data = OpWrite, b
+	return nil
+}
+
+// modifiedChanges is ChangeLog without the operations log.
+func (d *Driver) modifiedChanges(collection string, since time.Time) ([]Change, error) {
+	files, err := d.snapshotFiles(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, file := range files {
+		if file.ModTime().After(since) {
+			changes = append(changes, Change{Time: file.ModTime().UTC(), Op: OpWrite, Collection: collection, Resource: d.resourceName(file.Name())})
+		}
+	}
+
+	compare := d.keyComparator(collection)
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].Time.Equal(changes[j].Time) {
+			return changes[i].Time.Before(changes[j].Time)
+		}
+		return compare(changes[i].Resource, changes[j].Resource) < 0
+	})
+
+	filled := changes[:0]
+	for _, c := range changes {
+		if err := d.fillChange(&c); err != nil {
+			return nil, err
+		}
+		if c.Op == OpWrite {
+			filled = append(filled, c)
+		}
+	}
+
+	return filled, nil
+}
+
+// Replay applies changes, as returned by ChangeLog, in order: writes store
+// Data as the record's raw content, as Write would store it, and deletes
+// of records or collections that are already gone succeed, so replaying
+// overlapping change logs is harmless. It stops at the first failure,
+// leaving the changes before it applied.
+func (d *Driver) Replay(changes []Change) error {
+	for _, c := range changes {
+		var err error
+		switch c.Op {
+		case OpWrite:
+			err = d.replayWrite(c)
+		case OpDelete:
+			if err = d.Delete(c.Collection, c.Resource); errors.Is(err, ErrNotFound) {
+				err = nil
+			}
+		default:
+			err = fmt.Errorf("Invalid change '%s' - only %s and %s can be replayed!", c.Op, OpWrite, OpDelete)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Unable to replay change %d to '%s' in '%s' - %w", c.Seq, c.Resource, c.Collection, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) replayWrite(c Change) error {
+	if err := d.checkWrite(c.Collection, c.Resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(c.Collection, c.Resource)
+	defer unlock()
+
+	b, err := d.prepare(c.Collection, c.Resource, c.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.writeEncoded(c.Collection, c.Resource, b)
+	return err
+}
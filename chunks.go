@@ -0,0 +1,209 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// With Options.ChunkSize set, a record whose stored bytes exceed it is
+// split into parts of at most ChunkSize bytes, kept in a hidden ".chunks"
+// directory next to the record file as "<id>.part0", "<id>.part1" and so
+// on, and the record file itself holds a small manifest instead: chunkMagic
+// followed by the parts' id, count and total size. Reads recognise the
+// manifest, reassemble the parts and check their total size before
+// anything else - decryption, decoding - sees the record.
+//
+// Every chunked write uses a fresh id. The parts are written first, then the
+// manifest replaces the record file by an atomic rename, and only then are
+// the previous version's parts removed, so a crash leaves either the old
+// record or the new one, plus at worst some unreferenced part files. The
+// same goes for deletes, which remove the manifest before the parts. The
+// manifest is always renamed into place, whatever Options.WriteStrategy.
+//
+// Chunked records are recognised on read whatever the options, but only a
+// driver with ChunkSize set removes the parts of a record it overwrites
+// with an unchunked version; deletes always do.
+
+const (
+	chunkMagic = "GODBCHK1"
+	chunkDir   = ".chunks"
+)
+
+type chunkManifest struct {
+	ID    string `json:"id"`
+	Parts int    `json:"parts"`
+	Size  int    `json:"size"`
+}
+
+// checkChunkSize rejects chunking combined with layouts it can't work with.
+func checkChunkSize(opts Options) error {
+	switch {
+	case opts.ChunkSize < 0:
+		return fmt.Errorf("Invalid chunk size %d - must not be negative!", opts.ChunkSize)
+	case opts.ChunkSize == 0:
+		return nil
+	case opts.Exploded:
+		return fmt.Errorf("Invalid chunk size - exploded records can't be chunked!")
+	case opts.WriteStrategy == Append:
+		return fmt.Errorf("Invalid chunk size - records written with %v can't be chunked!", Append)
+	}
+
+	return nil
+}
+
+func chunkPath(path, id string, part int) string {
+	return filepath.Join(filepath.Dir(path), chunkDir, id+".part"+strconv.Itoa(part))
+}
+
+// readManifest returns the manifest held by the record file at path, or
+// nil if the file holds a plain record or doesn't exist.
+func readManifest(path string) (*chunkManifest, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(chunkMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != chunkMagic {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// A damaged manifest is simply overwritten; its parts are lost track of.
+	m, _ := parseManifest(path, b)
+	return m, nil
+}
+
+func parseManifest(path string, b []byte) (*chunkManifest, error) {
+	var m chunkManifest
+	if err := json.Unmarshal(b, &m); err != nil || m.ID == "" || m.Parts < 1 {
+		return nil, fmt.Errorf("%w - invalid chunk manifest in '%s'", ErrCorruptRecord, path)
+	}
+
+	return &m, nil
+}
+
+// writeChunked stores b at path as a manifest and parts.
+func (d *Driver) writeChunked(path string, b []byte) error {
+	old, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+
+	if err := d.mkdirAll(filepath.Join(filepath.Dir(path), chunkDir)); err != nil {
+		return err
+	}
+
+	m := chunkManifest{ID: newULID(d.opts.Clock()), Size: len(b)}
+
+	for rest := b; len(rest) > 0; m.Parts++ {
+		n := d.opts.ChunkSize
+		if n > len(rest) {
+			n = len(rest)
+		}
+
+		if err := ioutil.WriteFile(chunkPath(path, m.ID, m.Parts), rest[:n], 0644); err != nil {
+			d.removeChunks(path, &chunkManifest{ID: m.ID, Parts: m.Parts + 1})
+			return err
+		}
+		d.countWrite(n)
+
+		rest = rest[n:]
+	}
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	manifest = append([]byte(chunkMagic), manifest...)
+
+	if err := d.writeFileAtomic(path, manifest); err != nil {
+		d.removeChunks(path, &m)
+		return err
+	}
+	d.countWrite(len(manifest))
+	d.countTemp()
+	d.countRename()
+
+	d.removeChunks(path, old)
+	return nil
+}
+
+// removeChunks removes the parts listed by m, if any, best effort.
+func (d *Driver) removeChunks(path string, m *chunkManifest) {
+	if m == nil {
+		return
+	}
+
+	for i := 0; i < m.Parts; i++ {
+		os.Remove(chunkPath(path, m.ID, i))
+	}
+}
+
+// readStored reads the record file at path, reassembling it if chunked.
+func (d *Driver) readStored(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d.countRead(len(b))
+
+	if !bytes.HasPrefix(b, []byte(chunkMagic)) {
+		return b, nil
+	}
+
+	m, err := parseManifest(path, b[len(chunkMagic):])
+	if err != nil {
+		return nil, err
+	}
+
+	whole := make([]byte, 0, m.Size)
+
+	for i := 0; i < m.Parts; i++ {
+		part, err := ioutil.ReadFile(chunkPath(path, m.ID, i))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w - part %d of '%s' is missing", ErrCorruptRecord, i, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.countRead(len(part))
+
+		whole = append(whole, part...)
+	}
+
+	if len(whole) != m.Size {
+		return nil, fmt.Errorf("%w - parts of '%s' hold %d bytes, expected %d", ErrCorruptRecord, path, len(whole), m.Size)
+	}
+
+	return whole, nil
+}
+
+// removeStored removes the record file at path, then its parts if chunked.
+func (d *Driver) removeStored(path string) error {
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	d.removeChunks(path, m)
+	return nil
+}
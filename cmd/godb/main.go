@@ -0,0 +1,126 @@
+// Command godb reads and writes a godb database directory from the shell.
+//
+//	godb write  <dir> <collection> <resource> <file.json>
+//	godb read   <dir> <collection> <resource>
+//	godb list   <dir> <collection>
+//	godb delete <dir> <collection> <resource>
+//	godb export <dir> <collection>
+//
+// write reads the record from standard input when the file is "-". Results
+// are printed to standard output as JSON. The exit status is 2 when a
+// record or collection doesn't exist and 1 on any other error.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/jcelliott/lumber"
+	godb "github.com/kamoellen/go-database"
+)
+
+const usage = `usage:
+  godb write  <dir> <collection> <resource> <file.json>
+  godb read   <dir> <collection> <resource>
+  godb list   <dir> <collection>
+  godb delete <dir> <collection> <resource>
+  godb export <dir> <collection>
+`
+
+// arity is the number of arguments each command takes after its name.
+var arity = map[string]int{
+	"write":  4,
+	"read":   3,
+	"list":   2,
+	"delete": 3,
+	"export": 2,
+}
+
+func main() {
+	if len(os.Args) < 2 || arity[os.Args[1]] == 0 || len(os.Args)-2 != arity[os.Args[1]] {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "godb:", err)
+
+		if errors.Is(err, godb.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(cmd string, args []string) error {
+	db, err := godb.New(args[0], &godb.Options{Logger: lumber.NewBasicLogger(os.Stderr, lumber.WARN)})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	collection := args[1]
+
+	switch cmd {
+	case "write":
+		b, err := readInput(args[3])
+		if err != nil {
+			return err
+		}
+
+		if !json.Valid(b) {
+			return fmt.Errorf("%s is not valid JSON", args[3])
+		}
+
+		return db.Write(collection, args[2], json.RawMessage(b))
+	case "read":
+		var record json.RawMessage
+		if err := db.Read(collection, args[2], &record); err != nil {
+			return err
+		}
+
+		return printJSON(record)
+	case "list":
+		names := []string{}
+		err := db.ForEach(collection, func(resource string, data []byte) error {
+			names = append(names, resource)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(names)
+	case "delete":
+		return db.Delete(collection, args[2])
+	case "export":
+		records, err := db.ReadAllRawMap(collection)
+		if err != nil {
+			return err
+		}
+
+		return printJSON(records)
+	}
+
+	return nil
+}
+
+func readInput(file string) ([]byte, error) {
+	if file == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(file)
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Println(string(b))
+	return err
+}
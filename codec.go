@@ -0,0 +1,118 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec turns records into the bytes stored on disk and back. Extension is
+// the file name suffix of its records, including the dot.
+//
+// Everything that looks inside records - timestamps, schemas, patches,
+// field paths, aggregates, ReadDefaults, DisallowUnknownFields, the
+// maintenance methods, export and the raw JSON accessors - assumes
+// JSONCodec, as do Exploded storage, the Append write strategy and
+// QuarantineCorrupt, which New refuses to combine with another codec. Other
+// codecs support plain reads, writes, deletes and listings.
+type Codec interface {
+	Extension() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec stores records as tab-indented JSON in ".json" files. It is the
+// default.
+type JSONCodec struct{}
+
+func (JSONCodec) Extension() string { return ".json" }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "\t")
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec stores records with encoding/gob in ".gob" files, which keeps
+// Go types such as time.Time, named types and integer widths exact across
+// a round trip; like JSON, it skips unexported fields. Records are only
+// readable by Go programs decoding into compatible types, and values
+// stored in interface fields must have their concrete types registered
+// with gob.Register, in every program reading them, before use.
+type GobCodec struct{}
+
+func (GobCodec) Extension() string { return ".gob" }
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// BlobCodec stores records as the bytes they are in ".bin" files: Marshal
+// takes a []byte, or a string, and Unmarshal fills a *[]byte. It suits
+// images and other opaque content, typically as one of Options.Codecs
+// next to JSON records. See content.go.
+type BlobCodec struct{}
+
+func (BlobCodec) Extension() string { return ".bin" }
+
+func (BlobCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+	return nil, fmt.Errorf("Unable to store %T as a blob - need []byte or string!", v)
+}
+
+func (BlobCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("Unable to read a blob into %T - need *[]byte!", v)
+	}
+	*b = append([]byte(nil), data...)
+	return nil
+}
+
+// jsonRecords reports whether records are stored as JSON, which most of the
+// package's features rely on.
+func (d *Driver) jsonRecords() bool {
+	_, ok := d.opts.Codec.(JSONCodec)
+	return ok
+}
+
+// ext is the file name suffix of record files.
+func (d *Driver) ext() string {
+	return d.opts.Codec.Extension()
+}
+
+// checkCodec rejects options that only work with JSON records.
+func checkCodec(opts Options) error {
+	if _, ok := opts.Codec.(JSONCodec); ok {
+		return nil
+	}
+
+	switch {
+	case opts.Exploded:
+		return fmt.Errorf("Invalid codec - exploded storage needs JSON records!")
+	case opts.WriteStrategy == Append:
+		return fmt.Errorf("Invalid codec - the %v write strategy needs JSON records!", Append)
+	case opts.QuarantineCorrupt:
+		return fmt.Errorf("Invalid codec - QuarantineCorrupt needs JSON records!")
+	case len(opts.EncryptedFields) > 0:
+		return fmt.Errorf("Invalid codec - EncryptedFields needs JSON records!")
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const configFile = ".config.json"
+
+// CollectionConfig holds per-collection settings. It is persisted as
+// ".config.json" at the root of the collection, so a collection keeps its
+// settings across runs without them being re-specified in code. Settings
+// in the config take effect in addition to the driver-wide Options.
+type CollectionConfig struct {
+	Timestamps bool `json:"timestamps,omitempty"`
+
+	// Schema, if set, is checked by every write to the collection and by
+	// ValidateCollection. See Schema.
+	Schema *Schema `json:"schema,omitempty"`
+
+	// Indexes lists the fields, as dotted paths, that FindBy can look up
+	// without reading the whole collection. CreateIndex adds to it and
+	// builds the index at once; one listed here without its index file is
+	// built by the first FindBy. See index.go.
+	Indexes []string `json:"indexes,omitempty"`
+}
+
+// CollectionConfig returns the settings stored for collection. The config
+// file is read on first access and cached; a collection without one has a
+// zero CollectionConfig.
+func (d *Driver) CollectionConfig(collection string) (CollectionConfig, error) {
+	d.mutex.Lock()
+	cfg, ok := d.configs[collection]
+	d.mutex.Unlock()
+
+	if ok {
+		return cfg, nil
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(d.collectionDir(collection), configFile))
+	switch {
+	case os.IsNotExist(err):
+		return CollectionConfig{}, nil
+	case err != nil:
+		return CollectionConfig{}, err
+	}
+
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return CollectionConfig{}, fmt.Errorf("Invalid config for collection '%s': %v", collection, err)
+	}
+
+	d.mutex.Lock()
+	d.configs[collection] = cfg
+	d.mutex.Unlock()
+
+	return cfg, nil
+}
+
+// ConfigureCollection persists cfg as the settings for collection, creating
+// the collection if needed.
+func (d *Driver) ConfigureCollection(collection string, cfg CollectionConfig) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - nothing to configure!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	return d.saveConfig(collection, cfg)
+}
+
+// saveConfig is ConfigureCollection under the collection lock.
+func (d *Driver) saveConfig(collection string, cfg CollectionConfig) error {
+	b, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := d.mkdirAll(d.collectionDir(collection)); err != nil {
+		return err
+	}
+
+	if err := d.writeFileAtomic(filepath.Join(d.collectionDir(collection), configFile), append(b, byte('\n'))); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	d.configs[collection] = cfg
+	d.mutex.Unlock()
+
+	return nil
+}
+
+// CreateCollection creates collection with cfg as its settings, so they
+// apply from its first write. It fails with ErrCollectionExists if the
+// collection already exists, frozen or not.
+func (d *Driver) CreateCollection(collection string, cfg CollectionConfig) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - nothing to create!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationWrite, collection, ""); err != nil {
+		return err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	if d.frozen(collection) {
+		return ErrCollectionExists
+	}
+
+	dir := d.collectionDir(collection)
+
+	if err := d.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+
+	if err := d.mkdir(dir); err != nil {
+		if os.IsExist(err) {
+			return ErrCollectionExists
+		}
+		return err
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		os.Remove(dir)
+		return err
+	}
+
+	if err := d.writeFileAtomic(filepath.Join(dir, configFile), append(b, byte('\n'))); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	d.mutex.Lock()
+	d.configs[collection] = cfg
+	d.mutex.Unlock()
+
+	return nil
+}
+
+// DropCollection deletes collection with all its records and settings, like
+// Delete with an empty resource. It fails with ErrNotFound if the
+// collection doesn't exist.
+func (d *Driver) DropCollection(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - nothing to drop!")
+	}
+
+	return d.Delete(collection, "")
+}
@@ -0,0 +1,86 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileVersion identifies the state of a record file as seen by this driver.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func (d *Driver) statRecord(collection, resource string) (os.FileInfo, error) {
+	if d.opts.Exploded {
+		fi, err := os.Stat(d.explodedDir(collection, resource))
+		if !os.IsNotExist(err) {
+			return fi, err
+		}
+	}
+
+	return os.Stat(d.recordPath(collection, resource))
+}
+
+// noteVersion remembers the current state of a record's file as the one this
+// driver last saw, for resolveConflict.
+func (d *Driver) noteVersion(collection, resource string) {
+	fi, err := d.statRecord(collection, resource)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key := d.recordKey(collection, resource)
+	if err != nil {
+		delete(d.versions, key)
+		return
+	}
+	d.versions[key] = fileVersion{fi.ModTime(), fi.Size()}
+}
+
+// resolveConflict hands b and the stored record to Options.OnConflict when
+// the record's file changed since this driver last read or wrote it, and
+// returns the bytes to write instead of b. The caller must hold the lock.
+func (d *Driver) resolveConflict(collection, resource string, b []byte) ([]byte, error) {
+	d.mutex.Lock()
+	seen, ok := d.versions[d.recordKey(collection, resource)]
+	d.mutex.Unlock()
+
+	if !ok {
+		return b, nil
+	}
+
+	fi, err := d.statRecord(collection, resource)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.ModTime().Equal(seen.modTime) && fi.Size() == seen.size {
+		return b, nil
+	}
+
+	var existing []byte
+	err = d.io(func() (err error) {
+		existing, err = d.loadRecord(collection, resource)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := d.opts.OnConflict(existing, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(merged) {
+		return nil, fmt.Errorf("Unable to resolve conflict on '%s' in '%s' - the result is not valid JSON!", resource, collection)
+	}
+
+	return d.terminate(merged), nil
+}
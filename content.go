@@ -0,0 +1,296 @@
+package godb
+
+import (
+	"fmt"
+	"mime"
+	"os"
+)
+
+// A record's content type is the codec it was written with, and is tagged
+// by nothing but its file's extension - "<resource>.json", "<resource>.gob",
+// "<resource>.bin" - so the tag lives in the same directory entry as the
+// data and is replaced with it by the single rename of every write; there
+// is no separate metadata to fall out of sync. Changing a record's type
+// with WriteTyped writes the new file before removing the old one, so a
+// crash in between leaves both, and the typed methods use the more
+// recently modified until the next WriteTyped or Delete removes the other.
+//
+// ReadTyped and ContentType recognise Options.Codec and Options.Codecs.
+// Everything else - Read, ReadAll, ForEach, listings and the features
+// looking inside records - only sees the records of Options.Codec, while
+// Delete removes a record whatever its type. Records of the other codecs
+// are encrypted and go through the pipelines like any other, but can't be
+// combined with Options.Exploded, Options.UseEnvelope or a collection's
+// Options.EncryptedFields, which all need JSON, and aren't cached.
+
+// ContentTyper is implemented by codecs that know the MIME type of their
+// records. For other codecs ContentType goes by the extension, falling back
+// to "application/octet-stream".
+type ContentTyper interface {
+	ContentType() string
+}
+
+func (JSONCodec) ContentType() string { return "application/json" }
+func (GobCodec) ContentType() string  { return "application/x-gob" }
+func (BlobCodec) ContentType() string { return "application/octet-stream" }
+
+func contentType(c Codec) string {
+	if t, ok := c.(ContentTyper); ok {
+		return t.ContentType()
+	}
+
+	if t := mime.TypeByExtension(c.Extension()); t != "" {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
+// checkCodecs rejects extra codecs whose records can't be told apart.
+func checkCodecs(opts Options) error {
+	seen := map[string]bool{opts.Codec.Extension(): true}
+
+	for _, c := range opts.Codecs {
+		if c == nil || c.Extension() == "" {
+			return fmt.Errorf("Invalid codecs - every codec needs an extension!")
+		}
+
+		if seen[c.Extension()] {
+			return fmt.Errorf("Invalid codecs - more than one codec uses %s files!", c.Extension())
+		}
+		seen[c.Extension()] = true
+	}
+
+	return nil
+}
+
+// typedFile finds the file holding resource in collection among the
+// codecs' extensions, failing with ErrNotFound if there is none.
+func (d *Driver) typedFile(collection, resource string) (Codec, string, error) {
+	var found Codec
+	var path string
+	var newest os.FileInfo
+
+	for _, c := range append([]Codec{d.opts.Codec}, d.opts.Codecs...) {
+		p := d.recordPathExt(collection, resource, c.Extension())
+
+		var fi os.FileInfo
+		err := d.io(func() (err error) {
+			fi, err = os.Stat(p)
+			return err
+		})
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if newest == nil || fi.ModTime().After(newest.ModTime()) {
+			found, path, newest = c, p, fi
+		}
+	}
+
+	if found == nil {
+		return nil, "", ErrNotFound
+	}
+
+	return found, path, nil
+}
+
+// ContentType returns the MIME type of resource in collection, e.g.
+// "application/json", as described at the top of content.go. It fails with
+// ErrNotFound if the record doesn't exist.
+func (d *Driver) ContentType(collection, resource string) (string, error) {
+	if collection == "" {
+		return "", fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return "", fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return "", err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return "", err
+	}
+
+	c, _, err := d.typedFile(collection, resource)
+	if err != nil {
+		return "", err
+	}
+
+	return contentType(c), nil
+}
+
+// ReadTyped reads resource in collection into v with the codec it was
+// written with: records of Options.Codec are read as Read does, others
+// with the matching codec of Options.Codecs, so v must suit the record's
+// type - a *[]byte for BlobCodec records.
+func (d *Driver) ReadTyped(collection, resource string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return err
+	}
+
+	c, path, err := d.typedFile(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if c.Extension() == d.ext() {
+		return d.Read(collection, resource, v)
+	}
+
+	var b []byte
+	err = d.io(func() (err error) {
+		b, err = d.readStored(path)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if b, err = d.open(collection, resource, b); err != nil {
+		return err
+	}
+
+	return c.Unmarshal(b, v)
+}
+
+// WriteTyped writes v to resource in collection with codec, which must be
+// Options.Codec or one of Options.Codecs, and removes the record's files
+// of any other type afterwards. With Options.Codec it is Write.
+func (d *Driver) WriteTyped(collection, resource string, codec Codec, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	if codec == nil {
+		return fmt.Errorf("Unable to write '%s' in '%s' - missing codec!", resource, collection)
+	}
+
+	known := codec.Extension() == d.ext()
+	for _, c := range d.opts.Codecs {
+		known = known || c.Extension() == codec.Extension()
+	}
+	if !known {
+		return fmt.Errorf("Unable to write '%s' in '%s' - %s files aren't among Options.Codecs!", resource, collection, codec.Extension())
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	var err error
+	if codec.Extension() == d.ext() {
+		err = d.write(collection, resource, v)
+	} else {
+		err = d.writeTyped(collection, resource, codec, v)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.dropTyped(collection, resource, codec.Extension()); err != nil {
+		return err
+	}
+
+	if codec.Extension() != d.ext() {
+		d.reindex(collection, resource, nil)
+	}
+	return nil
+}
+
+// writeTyped stores a record of a codec other than Options.Codec.
+func (d *Driver) writeTyped(collection, resource string, codec Codec, v interface{}) error {
+	switch {
+	case d.opts.Exploded, d.opts.UseEnvelope:
+		return fmt.Errorf("Unable to write '%s' in '%s' - exploded and enveloped records need JSON!", resource, collection)
+	case len(d.opts.EncryptedFields[collection]) > 0:
+		return fmt.Errorf("Unable to write '%s' in '%s' - records of a collection with encrypted fields need JSON!", resource, collection)
+	}
+
+	if err := d.FenceCheck(); err != nil {
+		return err
+	}
+
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := codec.(JSONCodec); ok {
+		b = d.terminate(b)
+	}
+
+	stored, err := d.seal(collection, resource, b)
+	if err != nil {
+		return err
+	}
+
+	path := d.recordPathExt(collection, resource, codec.Extension())
+
+	err = d.io(func() error {
+		if err := d.mkdirAll(d.collectionDir(collection)); err != nil {
+			return err
+		}
+		return d.writeFileAtomic(path, stored)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.cache.remove(collection, resource)
+	d.trace(OpWrite, collection, resource, len(b))
+	d.logKV(LevelInfo, "wrote record", "op", OpWrite, "collection", collection, "resource", resource, "path", path)
+
+	return d.mirrorOp("write", collection, resource, func(m *Driver) error {
+		if err := m.writeTyped(collection, resource, codec, v); err != nil {
+			return err
+		}
+		_, err := m.dropTyped(collection, resource, codec.Extension())
+		return err
+	})
+}
+
+// dropTyped removes the files of resource in collection of every codec
+// except the one using the extension keep, and reports whether there were
+// any.
+func (d *Driver) dropTyped(collection, resource, keep string) (bool, error) {
+	dropped := false
+
+	for _, c := range append([]Codec{d.opts.Codec}, d.opts.Codecs...) {
+		if c.Extension() == keep {
+			continue
+		}
+
+		path := d.recordPathExt(collection, resource, c.Extension())
+		err := d.io(func() error { return d.removeStored(path) })
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return dropped, err
+		}
+		dropped = true
+	}
+
+	return dropped, nil
+}
@@ -0,0 +1,137 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertCollection re-encodes the records of collection stored with the
+// codec from into the codec to, and returns how many it converted. Each
+// record is decoded into a fresh value from newRecord, e.g.
+// func() interface{} { return new(User) }, since codecs such as GobCodec
+// need the Go type to decode into; it is then written with to's extension
+// and its old file removed, under the record's lock. Every conversion is
+// logged.
+//
+// A conversion that stops part way, on an error or a crash, leaves each
+// record in one codec or the other; running it again converts the rest,
+// so it can simply be retried. Afterwards, open the database with
+// Options.Codec set to to: this driver keeps reading its own codec.
+func (d *Driver) ConvertCollection(collection string, from, to Codec, newRecord func() interface{}) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - nothing to convert!")
+	}
+
+	if from == nil || to == nil || newRecord == nil {
+		return 0, fmt.Errorf("Unable to convert '%s' - missing codec or record constructor!", collection)
+	}
+
+	if from.Extension() == to.Extension() {
+		return 0, fmt.Errorf("Unable to convert '%s' - both codecs use %s files!", collection, from.Extension())
+	}
+
+	if d.opts.Exploded {
+		return 0, fmt.Errorf("Unable to convert '%s' - exploded storage needs JSON records!", collection)
+	}
+
+	if d.opts.UseEnvelope {
+		return 0, fmt.Errorf("Unable to convert '%s' - enveloped records need JSON!", collection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	dir := d.collectionDir(collection)
+
+	var files []os.FileInfo
+	err := d.io(func() (err error) {
+		files, err = ioutil.ReadDir(dir)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	converted := 0
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, from.Extension()) {
+			continue
+		}
+
+		resource := d.decodeKey(strings.TrimSuffix(name, from.Extension()))
+
+		if err := d.authorize(OperationWrite, collection, resource); err != nil {
+			return converted, err
+		}
+
+		ok, err := d.convertRecord(collection, resource, filepath.Join(dir, name), from, to, newRecord)
+		if err != nil {
+			return converted, fmt.Errorf("Unable to convert '%s' in '%s': %w", resource, collection, err)
+		}
+
+		if ok {
+			converted++
+		}
+	}
+
+	return converted, nil
+}
+
+// convertRecord converts one record file, reporting false if it was gone.
+func (d *Driver) convertRecord(collection, resource, path string, from, to Codec, newRecord func() interface{}) (bool, error) {
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	b, err := d.readStored(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if b, err = d.open(collection, resource, b); err != nil {
+		return false, err
+	}
+
+	v := newRecord()
+	if err := from.Unmarshal(b, v); err != nil {
+		return false, err
+	}
+
+	if b, err = to.Marshal(v); err != nil {
+		return false, err
+	}
+
+	if _, ok := to.(JSONCodec); ok {
+		b = d.terminate(b)
+	}
+
+	stored, err := d.seal(collection, resource, b)
+	if err != nil {
+		return false, err
+	}
+
+	dst := d.recordPathExt(collection, resource, to.Extension())
+
+	if err := d.io(func() error { return d.writeFileAtomic(dst, stored) }); err != nil {
+		return false, err
+	}
+
+	if err := d.removeStored(path); err != nil {
+		return false, err
+	}
+
+	d.cache.remove(collection, resource)
+	d.logKV(LevelInfo, "converted record", "op", "convert", "collection", collection, "resource", resource, "path", dst)
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// KeyedRecord is a record's name and raw contents.
+type KeyedRecord struct {
+	Resource string
+	Data     []byte
+}
+
+// ScanFrom returns up to limit records of collection whose names sort after
+// afterResource, in name order (see Options.KeyComparator) whatever
+// Options.ReadOrder says, and the cursor to pass as afterResource to get the
+// next page - the name of the last record returned, or "" once the
+// collection is exhausted. Start with an empty afterResource. Since pages
+// are positioned by name rather than by offset, records inserted or deleted
+// between calls never make a scan skip or repeat other records; records
+// added behind the cursor are simply not seen.
+func (d *Driver) ScanFrom(collection, afterResource string, limit int) ([]KeyedRecord, string, error) {
+	if collection == "" {
+		return nil, "", fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if limit < 1 {
+		return nil, "", fmt.Errorf("Unable to scan '%s' - limit must be positive!", collection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, "", err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, "", err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return nil, "", err
+	}
+
+	compare := d.keyComparator(collection)
+
+	sort.Slice(names, func(i, j int) bool { return compare(names[i], names[j]) < 0 })
+	names = names[sort.Search(len(names), func(i int) bool { return compare(names[i], afterResource) > 0 }):]
+
+	var records []KeyedRecord
+
+	for i, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		records = append(records, KeyedRecord{name, b})
+
+		if len(records) == limit {
+			if i == len(names)-1 {
+				break
+			}
+			return records, name, nil
+		}
+	}
+
+	return records, "", nil
+}
+
+// ReadTimeRange returns the raw contents of every record of collection whose
+// name lies between from and to, both included, in byte-wise order, keyed by
+// resource name. It's meant for names that sort in time order, like ULIDs
+// from NewULID or names starting with an RFC3339 timestamp in UTC, where it
+// reads the records written in a time span; names of any other shape just
+// give a lexical range. The names are sorted and only the records in the
+// range are read, so the cost grows with the range, not the collection -
+// apart from listing the directory. For large ranges, page through with
+// ScanFrom instead. An empty from or to leaves that end open.
+func (d *Driver) ReadTimeRange(collection string, from, to string) (map[string][]byte, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+
+	records := make(map[string][]byte)
+
+	for _, name := range names[sort.SearchStrings(names, from):] {
+		if to != "" && name > to {
+			break
+		}
+
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records[name] = b
+	}
+
+	return records, nil
+}
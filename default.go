@@ -0,0 +1,47 @@
+package godb
+
+import "fmt"
+
+// Put writes v to Options.DefaultCollection, like Write.
+func (d *Driver) Put(resource string, v interface{}) error {
+	collection, err := d.defaultCollection()
+	if err != nil {
+		return err
+	}
+
+	return d.Write(collection, resource, v)
+}
+
+// Get reads a record of Options.DefaultCollection into v, like Read.
+func (d *Driver) Get(resource string, v interface{}) error {
+	collection, err := d.defaultCollection()
+	if err != nil {
+		return err
+	}
+
+	return d.Read(collection, resource, v)
+}
+
+// Del deletes a record of Options.DefaultCollection, like Delete. Unlike
+// Delete, an empty resource is an error rather than a request to drop the
+// whole collection.
+func (d *Driver) Del(resource string) error {
+	collection, err := d.defaultCollection()
+	if err != nil {
+		return err
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to delete record (no name)!")
+	}
+
+	return d.Delete(collection, resource)
+}
+
+func (d *Driver) defaultCollection() (string, error) {
+	if d.opts.DefaultCollection == "" {
+		return "", fmt.Errorf("Missing collection - Options.DefaultCollection is not set!")
+	}
+
+	return d.opts.DefaultCollection, nil
+}
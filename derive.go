@@ -0,0 +1,209 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// A derived collection is a materialized view: its records are whatever a
+// reduce function makes of every record of a source collection, written
+// with ReplaceCollection. Every write or delete of the source made through
+// the driver marks the view stale as part of the operation. By default the
+// view is then recomputed eagerly, by a goroutine that runs once the
+// operation has returned, so a burst of writes costs far fewer recomputes
+// than writes, and readers see the view lag until it's done. With
+// Options.LazyDerive nothing is recomputed until RefreshDerived is called;
+// DerivedStale tells whether it's due.
+//
+// Recomputing reads the whole source, so views suit small sources or rare
+// writes. Changes made by other processes don't mark anything stale,
+// writes made directly to a derived collection are lost at the next
+// recompute, and a derived collection can't be the source of another.
+
+type derivation struct {
+	source string
+	reduce func(allSource map[string][]byte) (map[string]interface{}, error)
+
+	// mu serializes recomputes; stale is set atomically by the source's
+	// writers.
+	mu    sync.Mutex
+	stale int32
+	wake  chan struct{}
+}
+
+// DeriveCollection makes derived a view of source computed by reduce,
+// which gets the raw contents of every source record keyed by resource
+// name and returns the records of derived, keyed the same way. It computes
+// the view at once, replacing whatever derived held, and registers it to
+// be kept up to date as described at the top of derive.go. The
+// registration lasts until Close.
+func (d *Driver) DeriveCollection(source, derived string, reduce func(allSource map[string][]byte) (map[string]interface{}, error)) error {
+	if source == "" || derived == "" {
+		return fmt.Errorf("Missing collection - unable to derive (no source or derived collection)!")
+	}
+
+	if reduce == nil {
+		return fmt.Errorf("Unable to derive '%s' - missing reduce function!", derived)
+	}
+
+	if source == derived {
+		return fmt.Errorf("Unable to derive '%s' - a collection can't be derived from itself!", derived)
+	}
+
+	if err := d.validateNames(source, derived); err != nil {
+		return err
+	}
+
+	dv := &derivation{source: source, reduce: reduce, wake: make(chan struct{}, 1)}
+
+	d.deriveMu.Lock()
+	stop := d.deriveStop
+	switch {
+	case stop == nil:
+		d.deriveMu.Unlock()
+		return ErrClosed
+	case d.derivations[derived] != nil:
+		d.deriveMu.Unlock()
+		return fmt.Errorf("Unable to derive '%s' - it is derived already!", derived)
+	case d.derivations[source] != nil:
+		d.deriveMu.Unlock()
+		return fmt.Errorf("Unable to derive '%s' - its source '%s' is derived itself!", derived, source)
+	}
+	for name, other := range d.derivations {
+		if other.source == derived {
+			d.deriveMu.Unlock()
+			return fmt.Errorf("Unable to derive '%s' - it is the source of '%s'!", derived, name)
+		}
+	}
+	if d.derivations == nil {
+		d.derivations = make(map[string]*derivation)
+	}
+	d.derivations[derived] = dv
+	d.deriveMu.Unlock()
+
+	if !d.opts.LazyDerive {
+		d.deriveWG.Add(1)
+		go d.keepDerived(derived, dv, stop)
+	}
+
+	return d.recompute(derived, dv)
+}
+
+// keepDerived recomputes an eager view whenever its source changes.
+func (d *Driver) keepDerived(derived string, dv *derivation, stop chan struct{}) {
+	defer d.deriveWG.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-dv.wake:
+		}
+
+		if err := d.recompute(derived, dv); err != nil {
+			d.logKV(LevelError, "unable to recompute derived collection", "op", "derive", "collection", derived, "source", dv.source, "error", err)
+		}
+	}
+}
+
+func (d *Driver) recompute(derived string, dv *derivation) error {
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+
+	// Cleared first, so a change landing during the recompute marks the
+	// view stale again.
+	atomic.StoreInt32(&dv.stale, 0)
+
+	all := make(map[string][]byte)
+	err := d.ForEach(dv.source, func(resource string, data []byte) error {
+		all[resource] = data
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		atomic.StoreInt32(&dv.stale, 1)
+		return err
+	}
+
+	records, err := dv.reduce(all)
+	if err == nil {
+		err = d.ReplaceCollection(derived, records)
+	}
+	if err != nil {
+		atomic.StoreInt32(&dv.stale, 1)
+		return fmt.Errorf("Unable to derive '%s' from '%s' - %w", derived, dv.source, err)
+	}
+
+	return nil
+}
+
+// noteChange marks the views of collection stale, waking eager ones.
+func (d *Driver) noteChange(collection string) {
+	d.deriveMu.RLock()
+	defer d.deriveMu.RUnlock()
+
+	for _, dv := range d.derivations {
+		if dv.source != collection {
+			continue
+		}
+
+		atomic.StoreInt32(&dv.stale, 1)
+		select {
+		case dv.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *Driver) derivation(derived string) (*derivation, error) {
+	d.deriveMu.RLock()
+	dv := d.derivations[derived]
+	d.deriveMu.RUnlock()
+
+	if dv == nil {
+		return nil, fmt.Errorf("Unable to refresh '%s' - it isn't a derived collection!", derived)
+	}
+
+	return dv, nil
+}
+
+// DerivedStale reports whether the source of derived has changed since
+// the view was last computed, or the last recompute failed.
+func (d *Driver) DerivedStale(derived string) (bool, error) {
+	dv, err := d.derivation(derived)
+	if err != nil {
+		return false, err
+	}
+
+	return atomic.LoadInt32(&dv.stale) == 1, nil
+}
+
+// RefreshDerived recomputes derived if it is stale, and is how views are
+// brought up to date under Options.LazyDerive.
+func (d *Driver) RefreshDerived(derived string) error {
+	dv, err := d.derivation(derived)
+	if err != nil {
+		return err
+	}
+
+	if atomic.LoadInt32(&dv.stale) == 0 {
+		return nil
+	}
+
+	return d.recompute(derived, dv)
+}
+
+// stopDerived stops the goroutines of eager views for Close.
+func (d *Driver) stopDerived() {
+	d.deriveMu.Lock()
+	stop := d.deriveStop
+	d.deriveStop = nil
+	d.deriveMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+
+	d.deriveWG.Wait()
+}
@@ -0,0 +1,121 @@
+package godb
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+)
+
+const modulePath = "github.com/kamoellen/go-database"
+
+// DBInfo is a snapshot of a database's shape and of the driver's
+// configuration, for bug reports and admin tools. It marshals to JSON.
+type DBInfo struct {
+	// Version is the version of this package the program was built with,
+	// "(devel)" when built from a working copy, or "unknown" without
+	// build information.
+	Version string
+
+	// SchemaVersion is the database's migration version.
+	SchemaVersion int
+
+	Dir         string
+	Collections []CollectionInfo
+
+	// Options holds the effective Options by field name. Encryption keys
+	// are reported as "[redacted]", functions as "set" and interfaces by
+	// type, and lists or maps of functions by their length; unset keys and
+	// functions are left out.
+	Options map[string]interface{}
+}
+
+// CollectionInfo describes one collection in a DBInfo.
+type CollectionInfo struct {
+	Name    string
+	Records int
+	Config  CollectionConfig
+}
+
+// Describe reports the package version, the database directory, every
+// collection with its record count and config, and the driver's options.
+func (d *Driver) Describe() (DBInfo, error) {
+	info := DBInfo{
+		Version: "unknown",
+		Dir:     d.dir,
+		Options: d.describeOptions(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == modulePath {
+			info.Version = bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath {
+				info.Version = dep.Version
+			}
+		}
+	}
+
+	var err error
+	if info.SchemaVersion, err = d.SchemaVersion(); err != nil {
+		return DBInfo{}, err
+	}
+
+	stats, err := d.CollectionStats()
+	if err != nil {
+		return DBInfo{}, err
+	}
+
+	collections, err := d.collections()
+	if err != nil {
+		return DBInfo{}, err
+	}
+
+	info.Collections = make([]CollectionInfo, 0, len(collections))
+	for _, collection := range collections {
+		cfg, err := d.CollectionConfig(collection)
+		if err != nil {
+			return DBInfo{}, err
+		}
+
+		info.Collections = append(info.Collections, CollectionInfo{collection, stats[collection], cfg})
+	}
+
+	return info, nil
+}
+
+func (d *Driver) describeOptions() map[string]interface{} {
+	opts := make(map[string]interface{})
+
+	v := reflect.ValueOf(d.opts)
+	for i := 0; i < v.NumField(); i++ {
+		name, f := v.Type().Field(i).Name, v.Field(i)
+
+		switch {
+		case name == "EncryptionKey" || name == "CollectionKeys":
+			if f.Len() > 0 {
+				opts[name] = "[redacted]"
+			}
+		case f.Kind() == reflect.Func:
+			if !f.IsNil() {
+				opts[name] = "set"
+			}
+		case (f.Kind() == reflect.Slice || f.Kind() == reflect.Map) && f.Type().Elem().Kind() == reflect.Func:
+			if f.Len() > 0 {
+				opts[name] = fmt.Sprintf("%d functions", f.Len())
+			}
+		case f.Kind() == reflect.Interface:
+			if !f.IsNil() {
+				opts[name] = fmt.Sprintf("%T", f.Interface())
+			}
+		default:
+			if s, ok := f.Interface().(fmt.Stringer); ok {
+				opts[name] = s.String()
+			} else {
+				opts[name] = f.Interface()
+			}
+		}
+	}
+
+	return opts
+}
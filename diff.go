@@ -0,0 +1,101 @@
+package godb
+
+import (
+	"os"
+	"sort"
+)
+
+// CollectionDiff lists the resources of one collection that differ between
+// two databases, each sorted by name.
+type CollectionDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// DiffResult maps collection names to their differences. Collections
+// without differences are left out.
+type DiffResult map[string]CollectionDiff
+
+// Diff compares the database with other, record by record. Added lists
+// records only other has, Removed records only d has, and Changed records
+// whose contents differ, compared by checksum. Records are streamed as in
+// ForEach, keeping only their checksums in memory; hidden and temp files are
+// not records and so are never compared.
+func (d *Driver) Diff(other *Driver) (DiffResult, error) {
+	ours, err := d.collections()
+	if err != nil {
+		return nil, err
+	}
+
+	theirs, err := other.collections()
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make(map[string]bool)
+	for _, collection := range append(ours, theirs...) {
+		collections[collection] = true
+	}
+
+	result := make(DiffResult)
+
+	for collection := range collections {
+		a, err := d.checksums(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := other.checksums(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		var diff CollectionDiff
+
+		for resource, sum := range a {
+			switch theirs, ok := b[resource]; {
+			case !ok:
+				diff.Removed = append(diff.Removed, resource)
+			case theirs != sum:
+				diff.Changed = append(diff.Changed, resource)
+			}
+		}
+
+		for resource := range b {
+			if _, ok := a[resource]; !ok {
+				diff.Added = append(diff.Added, resource)
+			}
+		}
+
+		if len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0 {
+			continue
+		}
+
+		sort.Strings(diff.Added)
+		sort.Strings(diff.Removed)
+		sort.Strings(diff.Changed)
+		result[collection] = diff
+	}
+
+	return result, nil
+}
+
+// checksums maps the records of collection to their checksums; a missing
+// collection has none.
+func (d *Driver) checksums(collection string) (map[string]string, error) {
+	sums := make(map[string]string)
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		sums[resource] = checksum(data)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sums, nil
+}
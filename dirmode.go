@@ -0,0 +1,66 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Directories the driver creates - the database directory, collections,
+// namespaces and the like - get mode 0755 less the umask, unless
+// Options.InheritDirMode is set. Then each new directory gets exactly the
+// permission and setgid bits of its parent, set with Chmod after Mkdir so
+// the umask can't strip them, which keeps group-shared trees shared: a
+// 2770 database directory gets 2770 collections, and so do the staging
+// directories that become collections, as in ReplaceCollection. Private
+// temp directories, like the root of a Snapshot, keep their own modes,
+// which the directories created inside them inherit.
+
+// mkdirAll is os.MkdirAll honouring Options.InheritDirMode.
+func (d *Driver) mkdirAll(dir string) error {
+	if !d.opts.InheritDirMode {
+		return os.MkdirAll(dir, 0755)
+	}
+
+	fi, err := os.Stat(dir)
+	if err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("Unable to create directory '%s' - a file is in the way!", dir)
+		}
+		return nil
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := d.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+
+	// Another goroutine may have won the race to create it.
+	if err := d.mkdir(dir); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// mkdir is os.Mkdir honouring Options.InheritDirMode; it fails if dir
+// already exists.
+func (d *Driver) mkdir(dir string) error {
+	if !d.opts.InheritDirMode {
+		return os.Mkdir(dir, 0755)
+	}
+
+	parent, err := os.Stat(filepath.Dir(dir))
+	if err != nil {
+		return err
+	}
+
+	mode := parent.Mode() & (os.ModePerm | os.ModeSetgid)
+
+	if err := os.Mkdir(dir, mode); err != nil {
+		return err
+	}
+
+	return os.Chmod(dir, mode)
+}
@@ -0,0 +1,69 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func dirMode(t *testing.T, dir string) os.FileMode {
+	t.Helper()
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Mode() & (os.ModePerm | os.ModeSetgid)
+}
+
+func TestInheritDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on Windows")
+	}
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0770|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+	want := dirMode(t, dir)
+
+	db, err := New(dir, &Options{InheritDirMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirMode(t, filepath.Join(dir, "users")); got != want {
+		t.Errorf("collection made by Write has mode %v, want %v", got, want)
+	}
+
+	err = db.ReplaceCollection("teams", map[string]interface{}{"a": map[string]string{"name": "A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dirMode(t, filepath.Join(dir, "teams")); got != want {
+		t.Errorf("collection made by ReplaceCollection has mode %v, want %v", got, want)
+	}
+
+	err = db.ReplaceCollection("users", map[string]interface{}{"el": map[string]string{"name": "El"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dirMode(t, filepath.Join(dir, "users")); got != want {
+		t.Errorf("collection replaced by ReplaceCollection has mode %v, want %v", got, want)
+	}
+
+	snap, err := db.Snapshot("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	root := dirMode(t, snap.dir)
+	if got := dirMode(t, filepath.Join(snap.dir, "users")); got != root {
+		t.Errorf("snapshot collection has mode %v, want its root's %v", got, root)
+	}
+}
@@ -0,0 +1,1380 @@
+// Package godb is a small document database storing every record as a JSON
+// file, "<dir>/<collection>/<resource>.json".
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcelliott/lumber"
+)
+
+const Version = "1.0.0"
+
+type (
+	Logger interface {
+		Fatal(string, ...interface{})
+		Error(string, ...interface{})
+		Warn(string, ...interface{})
+		Info(string, ...interface{})
+		Debug(string, ...interface{})
+		Trace(string, ...interface{})
+	}
+
+	Driver struct {
+		mutex           sync.Mutex
+		opsMu           sync.Mutex
+		migrateMu       sync.Mutex
+		seedMu          sync.Mutex
+		mutexes         map[string]*sync.RWMutex
+		resourceMutexes map[string]*resourceMutex
+		mutexUsers      map[string]int
+		lockStats       map[string]*LockStat
+		versions        map[string]fileVersion
+		migrations      map[int]Migration
+		configs         map[string]CollectionConfig
+		dir             string
+		log             Logger
+		opts            Options
+		release         func() error
+		cache           *recordCache
+		events          *eventHub
+		loads           map[string]*loadCall
+		replicas        []*Driver
+		mirror          *Driver
+		ciphers         *ciphers
+		fileSlots       chan struct{}
+		iostats         *ioCounters
+		async           *asyncQueue
+		inflight        *inflightOps
+		deriveMu        sync.RWMutex
+		derivations     map[string]*derivation
+		deriveStop      chan struct{}
+		deriveWG        sync.WaitGroup
+		fence           *fence
+		quotas          *quotaUsage
+		indexes         *indexSet
+	}
+)
+
+type Options struct {
+	Logger
+
+	// KeyValidator is called for every collection and resource name before
+	// it is used. Defaults to DefaultKeyValidator.
+	KeyValidator func(name string) error
+
+	// IDGenerator produces resource names for Insert. Defaults to NewULID,
+	// timestamped by Clock.
+	IDGenerator func() string
+
+	// Timestamps injects "createdAt" and "updatedAt" RFC3339 strings into
+	// every record that marshals to a JSON object. See stamp for details.
+	Timestamps bool
+
+	// ExclusiveLock makes New lock the database directory so a second
+	// process (or driver) opening it fails with ErrLocked until Close.
+	ExclusiveLock bool
+
+	// TraceOps appends a line to "_ops.log" in the database directory for
+	// every mutation the driver performs. Read it back with OpsLog.
+	TraceOps bool
+
+	// RecoverOnOpen makes New finish writes interrupted by a crash: a
+	// complete temp file whose record is missing is renamed into place, and
+	// any other leftover temp file is removed.
+	RecoverOnOpen bool
+
+	// ValidateOnOpen makes New run CheckStructure and log every anomaly it
+	// finds as a warning. New only fails, with ErrNotDatabase, if there are
+	// files at the top level of the directory, which suggests it isn't a
+	// database at all. It reads every record.
+	ValidateOnOpen bool
+
+	// Fencing makes New take over the database directory by bumping its
+	// epoch, so writes and deletes from drivers that opened it earlier with
+	// Fencing fail with ErrFenced. See FenceCheck for its limits.
+	Fencing bool
+
+	// KeyTag is the struct tag WriteAuto looks for to find a value's key
+	// field, as in `godb:"key"`. Defaults to "godb".
+	KeyTag string
+
+	// DisallowUnknownFields makes Read and ReadAll fail, naming the record,
+	// when a stored record has fields the destination type lacks.
+	DisallowUnknownFields bool
+
+	// OperationTimeout bounds each disk operation; one that takes longer
+	// fails with ErrTimeout. Zero means no timeout. See Driver.io.
+	OperationTimeout time.Duration
+
+	// CacheSize enables an in-memory LRU cache of up to CacheSize raw
+	// records, consulted before disk on reads. Zero disables the cache.
+	CacheSize int
+
+	// QuarantineCorrupt moves records that aren't valid JSON into
+	// ".quarantine/<collection>/" when Read or ReadAll come across them:
+	// ReadAll skips them and Read returns ErrCorruptRecord. See
+	// ListQuarantine.
+	QuarantineCorrupt bool
+
+	// RetryTornReads makes Read and ReadAll read a record again, after a
+	// short backoff, when it exists but reads back empty or invalid, in
+	// case another process is replacing it. Only multi-process setups need
+	// it. See readretry.go.
+	RetryTornReads bool
+
+	// PathStrategy lays out collections and records on disk. Defaults to
+	// DefaultLayout.
+	PathStrategy PathStrategy
+
+	// Exploded stores every record as a directory with one file per
+	// top-level field. See exploded.go for the trade-offs.
+	Exploded bool
+
+	// UseEnvelope stores every record wrapped with its metadata - a
+	// version and creation and update times - read back with ReadMeta.
+	// Reads unwrap records transparently. It needs JSON records; see
+	// envelope.go for switching existing databases.
+	UseEnvelope bool
+
+	// ResourceLocks locks single-record operations per record instead of
+	// per collection, so writes to different records of one collection can
+	// proceed in parallel. Collection-wide operations still lock the whole
+	// collection. See lockResource.
+	ResourceLocks bool
+
+	// LockStats records how long operations wait for collection locks; see
+	// Driver.LockStats.
+	LockStats bool
+
+	// ReadTransform, if set, rewrites a record's raw bytes before they are
+	// decoded by Read, ReadAll and ReadLatest, e.g. to shim legacy field
+	// names during a gradual migration. Stored files are left untouched.
+	ReadTransform func(collection string, data []byte) ([]byte, error)
+
+	// ReadPipeline and WritePipeline transform every record's bytes as
+	// they are read from and written to disk, e.g. to compress them;
+	// writes run WritePipeline in reverse. Unlike ReadTransform they apply
+	// to every read. See pipeline.go for how the two pair up.
+	ReadPipeline  []func([]byte) ([]byte, error)
+	WritePipeline []func([]byte) ([]byte, error)
+
+	// ReadDefaults maps collections to top-level fields and the values
+	// decoding fills in for records that lack the field, so a new field
+	// can get a meaningful default without rewriting old records. A stored
+	// value, even null, always wins, and ReadTransform runs first. Records
+	// that aren't JSON objects are left alone; stored files are untouched.
+	ReadDefaults map[string]map[string]interface{}
+
+	// OmitTrailingNewline stores records without the final newline that
+	// is otherwise appended to every file, by every write path. Reads
+	// accept either form.
+	OmitTrailingNewline bool
+
+	// Authorize, if set, is called before every read, write, delete and
+	// listing of records; a non-nil error aborts the call and is returned
+	// with its message unchanged, matching both itself and ErrUnauthorized
+	// under errors.Is. resource is empty for operations on a whole
+	// collection.
+	// Maintenance methods (Compact, Canonicalize, MapCollection, Migrate
+	// and the like) are not authorized.
+	Authorize func(op Operation, collection, resource string) error
+
+	// ReadOrder fixes the order in which ReadAll, ForEach, Stream and the
+	// other collection scans visit records. Defaults to ReadByName.
+	ReadOrder ReadOrder
+
+	// KeyComparator orders resource names wherever the driver sorts them:
+	// ReadByName and the ties of ReadByModTime, ScanFrom and
+	// RecentResources. It returns a negative number, zero or a positive
+	// number as a sorts before, like or after b. KeyComparators overrides
+	// it per collection. Defaults to byte-wise order; NaturalKeyOrder
+	// sorts "2" before "10".
+	KeyComparator  func(a, b string) int
+	KeyComparators map[string]func(a, b string) int
+
+	// OnConflict, if set, is called by Write and the other single-record
+	// writes when the record's file changed - presumably by another
+	// process - since this driver last read or wrote it. It gets the stored
+	// and the incoming bytes and returns what to write instead, or an error
+	// to abort the write. Records this driver hasn't read or written yet
+	// are written blindly. Detection costs a stat per read and write plus a
+	// read on conflict, and compares modification time and size only; it
+	// narrows the window for lost updates between processes but can't close
+	// it - use ExclusiveLock for that.
+	OnConflict func(existing, incoming []byte) ([]byte, error)
+
+	// EventBatchWindow, if positive, coalesces the events of each
+	// collection: the first change starts a window of this length, and a
+	// single Event listing every resource changed within it is delivered
+	// when it ends. Zero delivers one Event per change. See Subscribe.
+	EventBatchWindow time.Duration
+
+	// MaxRecordsPerCollection caps the number of records in every
+	// collection: a write adding a record to a full collection first
+	// deletes the records with the oldest modification times until there
+	// is room. Zero means unbounded.
+	MaxRecordsPerCollection int
+
+	// CollectionQuota bounds the records, bytes and write rate of the
+	// collections it names; a write that would break a bound fails with
+	// ErrQuotaExceeded instead of evicting. See quota.go for how usage is
+	// counted.
+	CollectionQuota map[string]Quota
+
+	// KeyEncoder maps collection and resource names to the names used on
+	// disk, and KeyDecoder maps them back for listings; set them to
+	// EscapeKey and UnescapeKey to store keys such as e-mail addresses or
+	// URLs without encoding them first. KeyValidator checks encoded names.
+	// Without a KeyDecoder, listings report the encoded names. Changing
+	// the encoding of an existing database hides records written with the
+	// old one.
+	KeyEncoder func(string) string
+	KeyDecoder func(string) string
+
+	// KeySeparator joins the parts of the keys Driver.CompoundKey builds,
+	// and defaults to DefaultKeySeparator. It may be several bytes, such
+	// as "__" or ":" (not valid in file names on Windows), but not contain
+	// '%', '.', NUL or a path separator, so compound keys still can't
+	// escape their collection directory.
+	KeySeparator string
+
+	// CaseInsensitiveKeys lower-cases resource names, before KeyEncoder,
+	// wherever they are used, so "Kamo" and "kamo" are the same record on
+	// every file system rather than only on case-insensitive ones, and
+	// listings and events report the lower-case form. Collection names
+	// keep their case. Records already stored under names with upper-case
+	// letters are hidden until renamed.
+	CaseInsensitiveKeys bool
+
+	// Clock returns the current time used for timestamps, the operations
+	// log, ReadFresh and the default IDGenerator. Defaults to time.Now;
+	// tests can inject a clock they advance by hand. Lock wait statistics
+	// always measure real time.
+	Clock func() time.Time
+
+	// ReadReplicas are read-only copies of the database, kept up to date by
+	// some outside process. Read and ReadAll fall back to them, in order,
+	// when the primary directory misses or times out. See replica.go.
+	ReadReplicas []string
+
+	// ReadConcurrency is the number of files ReadAll and ReadAllRawMap
+	// read at once, which pays off on high-latency storage such as a
+	// network file system. Results keep their usual order. Zero or one
+	// reads sequentially.
+	ReadConcurrency int
+
+	// DefaultCollection is the collection Put, Get and Del work on, for
+	// apps that only need one.
+	DefaultCollection string
+
+	// MirrorDir, if set, receives a copy of every record write and delete
+	// before the operation returns. A failure to update the mirror fails
+	// the operation, unless MirrorBestEffort is set, in which case it is
+	// logged. See mirror.go for what is and isn't mirrored.
+	MirrorDir        string
+	MirrorBestEffort bool
+
+	// ProbeWritable makes New create and delete a file in the database
+	// directory, so a read-only mount, a full disk or missing permissions
+	// fail New with ErrNotWritable instead of the first Write.
+	ProbeWritable bool
+
+	// Codecs are further codecs whose records WriteTyped, ReadTyped and
+	// ContentType handle next to those of Codec, each told apart by its
+	// extension. See content.go.
+	Codecs []Codec
+
+	// EncryptionKey and CollectionKeys encrypt records at rest with
+	// AES-GCM: a collection listed in CollectionKeys uses its own key,
+	// every other collection uses EncryptionKey, or no encryption if it is
+	// empty. Keys must be 16, 24 or 32 bytes. See encryption.go.
+	EncryptionKey  []byte
+	CollectionKeys map[string][]byte
+
+	// EncryptedFields lists, per collection, the dotted paths of the
+	// fields whose values are encrypted with the collection's key, leaving
+	// the rest of its records in plain JSON. See fieldcrypt.go.
+	EncryptedFields map[string][]string
+
+	// WriteStrategy selects how record files are updated. Defaults to
+	// AtomicRename; InPlace and Append can't be combined with Exploded,
+	// nor Append with encryption.
+	WriteStrategy WriteStrategy
+
+	// ChunkSize, if positive, stores records whose stored bytes exceed it
+	// as parts of at most ChunkSize bytes plus a manifest, reassembled on
+	// read. It can't be combined with Exploded or the Append write
+	// strategy. See chunks.go.
+	ChunkSize int
+
+	// MaxOpenFiles bounds the disk operations, each holding a file open
+	// or two, that run at once, so parallel reads of a huge collection
+	// can't exhaust the process's file descriptors (EMFILE). Zero means
+	// DefaultMaxOpenFiles; a negative value removes the bound.
+	MaxOpenFiles int
+
+	// Codec encodes records for storage. Defaults to JSONCodec; see Codec
+	// for what other codecs support.
+	Codec Codec
+
+	// SkipUnchangedWrites makes writes read the stored record first and
+	// leave it untouched - no file write, modification time bump, event or
+	// mirror write - when the new bytes are identical, at the cost of that
+	// read. With Timestamps a write stamps the current time, so it only
+	// matches the stored record within the same second. See WriteChanged.
+	SkipUnchangedWrites bool
+
+	// AsyncQueueSize bounds the writes WriteAsync holds before WriteAsync
+	// blocks, and AsyncWorkers is how many goroutines store them. They
+	// default to DefaultAsyncQueueSize and DefaultAsyncWorkers. A failed
+	// async write is passed to OnAsyncError, or logged if it is nil, and
+	// returned by the next Flush. See asyncwrite.go.
+	AsyncQueueSize int
+	AsyncWorkers   int
+	OnAsyncError   func(collection, resource string, err error)
+
+	// TrackInFlight records every operation holding or waiting for a lock,
+	// for InFlight.
+	TrackInFlight bool
+
+	// DisableIOStats turns off the counters behind IOStats, saving the
+	// atomic adds on every read and write.
+	DisableIOStats bool
+
+	// InheritDirMode makes every directory the driver creates copy the
+	// permission and setgid bits of its parent, whatever the umask, instead
+	// of getting 0755 less the umask. See dirmode.go.
+	InheritDirMode bool
+
+	// LazyDerive makes changes to the source of a derived collection only
+	// mark it stale, for RefreshDerived to recompute, instead of
+	// recomputing it in the background. See derive.go.
+	LazyDerive bool
+
+	// RebuildIndexes makes the driver treat every index as stale the first
+	// time it is used, instead of trusting its file, so the next FindBy
+	// rebuilds it from the records - for databases other processes write
+	// to. See index.go.
+	RebuildIndexes bool
+}
+
+// DefaultMaxOpenFiles is the default Options.MaxOpenFiles, a quarter of the
+// common soft limit of 1024 descriptors.
+const DefaultMaxOpenFiles = 256
+
+func New(dir string, options *Options) (*Driver, error) {
+	dir = filepath.Clean(dir)
+
+	opts := Options{}
+
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = lumber.NewConsoleLogger(lumber.INFO)
+	}
+
+	if opts.KeyValidator == nil {
+		opts.KeyValidator = DefaultKeyValidator
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	if opts.IDGenerator == nil {
+		clock := opts.Clock
+		opts.IDGenerator = func() string { return newULID(clock()) }
+	}
+
+	if opts.PathStrategy == nil {
+		opts.PathStrategy = DefaultLayout{}
+	}
+
+	if opts.KeyTag == "" {
+		opts.KeyTag = "godb"
+	}
+
+	if opts.KeySeparator == "" {
+		opts.KeySeparator = DefaultKeySeparator
+	}
+
+	if err := checkKeySeparator(opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+
+	if err := checkChunkSize(opts); err != nil {
+		return nil, err
+	}
+
+	if err := checkCodec(opts); err != nil {
+		return nil, err
+	}
+
+	if err := checkEnvelope(opts); err != nil {
+		return nil, err
+	}
+
+	if err := checkPipelines(opts); err != nil {
+		return nil, err
+	}
+
+	if err := checkCodecs(opts); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuotas(opts); err != nil {
+		return nil, err
+	}
+
+	if opts.MaxOpenFiles == 0 {
+		opts.MaxOpenFiles = DefaultMaxOpenFiles
+	}
+
+	if err := checkAsync(&opts); err != nil {
+		return nil, err
+	}
+
+	ciphers, err := newCiphers(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkEncryptedFields(opts, ciphers); err != nil {
+		return nil, err
+	}
+
+	if err := checkWriteStrategy(opts); err != nil {
+		return nil, err
+	}
+
+	driver := newDriver(dir, opts)
+
+	if _, err := os.Stat(dir); err == nil {
+		driver.logKV(LevelDebug, "using existing database", "op", "open", "dir", dir)
+	} else {
+		driver.logKV(LevelDebug, "creating database", "op", "open", "dir", dir)
+		if err := driver.mkdirAll(dir); err != nil {
+			return driver, err
+		}
+	}
+
+	if opts.ProbeWritable {
+		if err := probeWritable(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.ExclusiveLock {
+		if err := driver.acquireLock(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.ValidateOnOpen {
+		if err := driver.validateOnOpen(); err != nil {
+			driver.Close()
+			return nil, err
+		}
+	}
+
+	if opts.RecoverOnOpen {
+		if err := driver.recoverTemps(); err != nil {
+			driver.Close()
+			return nil, err
+		}
+	}
+
+	if opts.Fencing {
+		if err := driver.takeOver(); err != nil {
+			driver.Close()
+			return nil, err
+		}
+	}
+
+	if len(opts.CollectionQuota) > 0 {
+		if err := driver.loadQuotas(); err != nil {
+			driver.Close()
+			return nil, err
+		}
+	}
+
+	return driver, nil
+}
+
+func newDriver(dir string, opts Options) *Driver {
+	d := &Driver{
+		dir:             dir,
+		mutexes:         make(map[string]*sync.RWMutex),
+		resourceMutexes: make(map[string]*resourceMutex),
+		mutexUsers:      make(map[string]int),
+		lockStats:       make(map[string]*LockStat),
+		versions:        make(map[string]fileVersion),
+		events:          newEventHub(opts.EventBatchWindow),
+		loads:           make(map[string]*loadCall),
+		configs:         make(map[string]CollectionConfig),
+		log:             opts.Logger,
+		opts:            opts,
+		deriveStop:      make(chan struct{}),
+		quotas:          &quotaUsage{usage: make(map[string]*Usage)},
+		indexes:         &indexSet{},
+	}
+
+	if opts.CacheSize > 0 {
+		d.cache = newRecordCache(opts.CacheSize, opts.CaseInsensitiveKeys)
+	}
+
+	if opts.MaxOpenFiles > 0 {
+		d.fileSlots = make(chan struct{}, opts.MaxOpenFiles)
+	}
+
+	if !opts.DisableIOStats {
+		d.iostats = &ioCounters{}
+	}
+
+	// New has already rejected invalid keys.
+	d.ciphers, _ = newCiphers(opts)
+	d.inflight = newInflightOps(opts)
+	d.replicas = newReplicas(opts)
+	d.mirror = newMirror(opts)
+
+	return d
+}
+
+func (d *Driver) Write(collection, resource string, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	return d.write(collection, resource, v)
+}
+
+// WriteChanged is Write reporting whether it wrote anything: with
+// Options.SkipUnchangedWrites it returns false, having left the record
+// alone, when v encodes to exactly the stored bytes. Without the option it
+// always writes and returns true.
+func (d *Driver) WriteChanged(collection, resource string, v interface{}) (bool, error) {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return false, err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	return d.writeChanged(collection, resource, v)
+}
+
+// ValidateWrite runs every check Write would, including marshaling v, but
+// stops before touching disk. Use it to pre-flight a bulk import.
+func (d *Driver) ValidateWrite(collection, resource string, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	_, err := d.encode(collection, resource, v)
+	return err
+}
+
+// WriteVerified is Write for high-value data: it first marshals v,
+// unmarshals the result into a fresh value of v's type and fails with
+// ErrRoundTripMismatch unless the two are deeply equal, catching lossy
+// serialization (unexported fields, float precision, interface{} numbers
+// coming back as float64) at write time instead of on read.
+func (d *Driver) WriteVerified(collection, resource string, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	if v != nil {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		fresh := reflect.New(reflect.TypeOf(v))
+		if err := json.Unmarshal(b, fresh.Interface()); err != nil {
+			return fmt.Errorf("%w: %v", ErrRoundTripMismatch, err)
+		}
+
+		if !reflect.DeepEqual(fresh.Elem().Interface(), v) {
+			return ErrRoundTripMismatch
+		}
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	return d.write(collection, resource, v)
+}
+
+func (d *Driver) checkWrite(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to save record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	return d.authorize(OperationWrite, collection, resource)
+}
+
+// write marshals v and stores it; the caller must hold the collection lock.
+func (d *Driver) write(collection, resource string, v interface{}) error {
+	_, err := d.writeChanged(collection, resource, v)
+	return err
+}
+
+// writeChanged is write reporting whether the record was stored, which it
+// isn't under Options.SkipUnchangedWrites if it holds the same bytes
+// already.
+func (d *Driver) writeChanged(collection, resource string, v interface{}) (bool, error) {
+	b, err := d.encode(collection, resource, v)
+	if err != nil {
+		return false, err
+	}
+
+	return d.writeEncoded(collection, resource, b)
+}
+
+// writeEncoded is writeChanged for bytes encode has produced.
+func (d *Driver) writeEncoded(collection, resource string, b []byte) (bool, error) {
+	var err error
+
+	if d.opts.OnConflict != nil {
+		if b, err = d.resolveConflict(collection, resource, b); err != nil {
+			return false, err
+		}
+	}
+
+	if d.opts.SkipUnchangedWrites {
+		if current, err := d.readRecord(collection, resource); err == nil && sameRecord(current, b) {
+			return false, nil
+		}
+	}
+
+	if d.opts.MaxRecordsPerCollection > 0 {
+		if err := d.makeRoom(collection, resource); err != nil {
+			return false, err
+		}
+	}
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (d *Driver) encode(collection, resource string, v interface{}) ([]byte, error) {
+	b, err := d.opts.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.prepare(collection, resource, b)
+}
+
+// prepare is the part of encode after marshaling: it stamps JSON records,
+// checks them against the collection schema and terminates them.
+func (d *Driver) prepare(collection, resource string, b []byte) ([]byte, error) {
+	if !d.jsonRecords() {
+		return b, nil
+	}
+
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.opts.Timestamps || cfg.Timestamps {
+		if b, err = d.stamp(collection, resource, b); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Schema != nil {
+		if err := cfg.Schema.check(resource, b); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.terminate(b), nil
+}
+
+// terminate ends a record's bytes with exactly one newline, or with none
+// under Options.OmitTrailingNewline. Every path storing a record goes
+// through it so files look the same whichever method wrote them.
+func (d *Driver) terminate(b []byte) []byte {
+	b = bytes.TrimRight(b, "\n")
+	if d.opts.OmitTrailingNewline {
+		return b
+	}
+	return append(b, byte('\n'))
+}
+
+// writeRecord atomically replaces a record's file with b by writing a temp
+// file next to it and renaming it into place.
+func (d *Driver) writeRecord(collection, resource string, b []byte) error {
+	if err := d.FenceCheck(); err != nil {
+		return err
+	}
+
+	fnlPath := d.recordPath(collection, resource)
+	if d.opts.Exploded {
+		fnlPath = d.explodedDir(collection, resource)
+	}
+
+	record := b
+	if d.opts.UseEnvelope {
+		var err error
+		if record, err = d.envelop(collection, resource, b); err != nil {
+			return err
+		}
+	}
+
+	stored, err := d.seal(collection, resource, record)
+	if err != nil {
+		return err
+	}
+
+	release, err := d.reserveQuota(collection, fnlPath, int64(len(stored)))
+	if err != nil {
+		return err
+	}
+
+	if err := d.io(func() error { return d.storeRecord(fnlPath, stored) }); err != nil {
+		release()
+		return err
+	}
+
+	if d.opts.Exploded {
+		// A record written before switching to exploded storage is
+		// superseded by its directory.
+		os.Remove(d.recordPath(collection, resource))
+	}
+
+	if d.opts.OnConflict != nil {
+		d.noteVersion(collection, resource)
+	}
+
+	d.cache.put(collection, resource, b)
+	d.reindex(collection, resource, b)
+	d.trace(OpWrite, collection, resource, len(b))
+	d.logKV(LevelInfo, "wrote record", "op", OpWrite, "collection", collection, "resource", resource, "path", fnlPath)
+
+	return d.mirrorOp("write", collection, resource, func(m *Driver) error {
+		return m.writeRecord(collection, resource, b)
+	})
+}
+
+func (d *Driver) storeRecord(path string, b []byte) error {
+	if d.opts.Exploded {
+		return d.writeExploded(path, b)
+	}
+
+	if d.opts.ChunkSize > 0 {
+		if len(b) > d.opts.ChunkSize {
+			return d.writeChunked(path, b)
+		}
+
+		old, err := readManifest(path)
+		if err != nil {
+			return err
+		}
+		if err := d.writeFile(path, b); err != nil {
+			return err
+		}
+		d.removeChunks(path, old)
+		return nil
+	}
+
+	return d.writeFile(path, b)
+}
+
+func (d *Driver) loadRecord(collection, resource string) ([]byte, error) {
+	b, err := d.loadVersion(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.unwrap(b), nil
+}
+
+// loadVersion is loadRecord leaving the record in its envelope.
+func (d *Driver) loadVersion(collection, resource string) ([]byte, error) {
+	if d.opts.Exploded {
+		b, err := d.readExploded(d.explodedDir(collection, resource))
+		if !os.IsNotExist(err) {
+			return b, err
+		}
+	}
+
+	return d.readFile(collection, resource, d.recordPath(collection, resource))
+}
+
+// writeFileAtomic writes b to path through a temp file renamed over it,
+// creating the directory if needed.
+func (d *Driver) writeFileAtomic(path string, b []byte) error {
+	tmpPath := path + ".tmp"
+
+	if err := d.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(tmpPath, b, 0644); err != nil {
+		return err
+	}
+
+	err := os.Rename(tmpPath, path)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	// Some overlay and bind mounts refuse renames even within a directory.
+	// Overwriting in place is the best left to do; a crash midway can
+	// leave the file truncated, but the temp file is removed only once the
+	// final file is complete, so Options.RecoverOnOpen can still repair it.
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Remove(tmpPath)
+}
+
+func (d *Driver) Read(collection, resource string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return err
+	}
+
+	return d.read(collection, resource, v)
+}
+
+// read is Read once the names are checked and the read authorized.
+func (d *Driver) read(collection, resource string, v interface{}) error {
+	b, err := d.readRecord(collection, resource)
+	if replicable(err) {
+		b, err = d.readReplica(collection, resource, err)
+	}
+	if err == ErrNotFound && d.frozen(collection) {
+		return ErrFrozen
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.opts.QuarantineCorrupt && !json.Valid(b) {
+		if err := d.quarantine(collection, resource); err != nil {
+			return err
+		}
+		return ErrCorruptRecord
+	}
+
+	return d.decode(collection, resource, b, v)
+}
+
+// ReadOK is Read for lookups where a missing record is expected: it returns
+// false and a nil error, leaving v untouched, instead of ErrNotFound. Any
+// other failure, such as a corrupt record, is returned as is.
+func (d *Driver) ReadOK(collection, resource string, v interface{}) (bool, error) {
+	err := d.Read(collection, resource, v)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Equals reports whether the stored record is byte for byte what v
+// marshals to with the Codec, ignoring trailing newlines, without decoding
+// the record. It marshals v as is, so a record stamped by
+// Options.Timestamps or filled in from defaults never equals the value it
+// was written from. It returns ErrNotFound if the record is absent.
+func (d *Driver) Equals(collection, resource string, v interface{}) (bool, error) {
+	if collection == "" {
+		return false, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return false, fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return false, err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return false, err
+	}
+
+	b, err := d.opts.Codec.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := d.readRecord(collection, resource)
+	if err != nil {
+		return false, err
+	}
+
+	return sameRecord(current, b), nil
+}
+
+// sameRecord compares two records' bytes, ignoring trailing newlines.
+func sameRecord(a, b []byte) bool {
+	return bytes.Equal(bytes.TrimRight(a, "\n"), bytes.TrimRight(b, "\n"))
+}
+
+// ReadFresh is Read for records that must be recent: it fails with ErrStale,
+// leaving the record in place, when the record's file was last modified
+// more than maxAge ago.
+func (d *Driver) ReadFresh(collection, resource string, v interface{}, maxAge time.Duration) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	// Authorized before the stat, so a refused caller can't tell from
+	// ErrNotFound and ErrStale whether the record exists or how old it is.
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return err
+	}
+
+	fi, err := d.statRecord(collection, resource)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.opts.Clock().Sub(fi.ModTime()) > maxAge {
+		return ErrStale
+	}
+
+	return d.read(collection, resource, v)
+}
+
+func (d *Driver) decode(collection, resource string, b []byte, v interface{}) error {
+	if d.opts.ReadTransform != nil {
+		var err error
+		if b, err = d.opts.ReadTransform(collection, b); err != nil {
+			return fmt.Errorf("Unable to transform record '%s' in '%s': %w", resource, collection, err)
+		}
+	}
+
+	if !d.jsonRecords() {
+		return d.opts.Codec.Unmarshal(b, v)
+	}
+
+	if defaults := d.opts.ReadDefaults[collection]; len(defaults) > 0 {
+		var err error
+		if b, err = applyDefaults(b, defaults); err != nil {
+			return fmt.Errorf("Unable to apply defaults to record '%s' in '%s': %w", resource, collection, err)
+		}
+	}
+
+	if !d.opts.DisallowUnknownFields {
+		return json.Unmarshal(b, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("Unable to decode record '%s' in '%s': %w", resource, collection, err)
+	}
+
+	return nil
+}
+
+// ReadAll decodes every record of collection into the slice v points to,
+// appending one element per record, e.g.
+//
+//	var users []User
+//	err := db.ReadAll("users", &users)
+//
+// An existing collection without records leaves an empty, non-nil slice; a
+// collection that doesn't exist fails with ErrCollectionNotFound.
+func (d *Driver) ReadAll(collection string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to read")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return err
+	}
+
+	out := reflect.ValueOf(v)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Unable to read all records - expected a pointer to a slice, got %T!", v)
+	}
+	records := out.Elem()
+	n := records.Len()
+
+	err := d.readAll(collection, records)
+	if replicable(err) {
+		for _, replica := range d.replicas {
+			records.SetLen(n)
+			if rerr := replica.readAll(collection, records); !replicable(rerr) {
+				return rerr
+			}
+		}
+		records.SetLen(n)
+
+		if d.frozen(collection) {
+			return ErrFrozen
+		}
+	}
+
+	if err == nil && records.IsNil() {
+		records.Set(reflect.MakeSlice(records.Type(), 0, 0))
+	}
+
+	return err
+}
+
+// readAll appends the records of collection to the slice records.
+func (d *Driver) readAll(collection string, records reflect.Value) error {
+	dir := d.collectionDir(collection)
+
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return &ioError{ErrCollectionNotFound, err}
+		}
+		return err
+	}
+
+	var files []os.FileInfo
+	err := d.io(func() (err error) {
+		files, err = ioutil.ReadDir(dir)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	files = followLinks(dir, files)
+	d.sortFiles(collection, files)
+
+	kept := files[:0]
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") || file.IsDir() && !d.opts.Exploded || !file.IsDir() && !strings.HasSuffix(file.Name(), d.ext()) {
+			continue
+		}
+		kept = append(kept, file)
+	}
+	files = kept
+
+	contents := make([][]byte, len(files))
+	err = d.parallel(len(files), func(i int) error {
+		return d.io(func() (err error) {
+			if files[i].IsDir() {
+				contents[i], err = d.readExploded(filepath.Join(dir, files[i].Name()))
+				contents[i] = d.unwrap(contents[i])
+				return err
+			}
+			if contents[i], err = d.readFile(collection, d.resourceName(files[i].Name()), filepath.Join(dir, files[i].Name())); err != nil {
+				return err
+			}
+			contents[i] = d.unwrap(contents[i])
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		b := contents[i]
+		resource := d.resourceName(file.Name())
+
+		if d.opts.QuarantineCorrupt && resource != file.Name() && !json.Valid(b) {
+			if err := d.quarantine(collection, resource); err != nil {
+				return err
+			}
+			continue
+		}
+
+		record := reflect.New(records.Type().Elem())
+		if err := d.decode(collection, resource, b, record.Interface()); err != nil {
+			return err
+		}
+
+		records.Set(reflect.Append(records, record.Elem()))
+	}
+
+	return nil
+}
+
+func (d *Driver) Delete(collection, resource string) error {
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if resource != "" {
+		if err := d.validateNames(resource); err != nil {
+			return err
+		}
+	}
+
+	if err := d.authorize(OperationDelete, collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	return d.delete(collection, resource)
+}
+
+// delete removes a record, or the whole collection when resource is empty;
+// the caller must hold the collection lock.
+func (d *Driver) delete(collection, resource string) error {
+	if err := d.FenceCheck(); err != nil {
+		return err
+	}
+
+	dir := d.collectionDir(collection)
+	record := d.recordPath(collection, resource)
+
+	if resource != "" {
+		dir = filepath.Join(dir, d.encodeResource(resource))
+	}
+
+	var freed int64
+	if _, ok := d.opts.CollectionQuota[collection]; ok && resource != "" {
+		var exploded bool
+		if freed, exploded, _ = d.storedSize(dir); !exploded {
+			freed, _, _ = d.storedSize(record)
+		}
+	}
+
+	switch fi, err := os.Stat(dir); {
+	case err == nil && fi.Mode().IsDir():
+		if resource == "" {
+			d.mutex.Lock()
+			delete(d.configs, collection)
+			d.mutex.Unlock()
+		}
+
+		if err := d.io(func() error { return os.RemoveAll(dir) }); err != nil {
+			return err
+		}
+	default:
+		_, err := os.Stat(record)
+
+		// Records of Options.Codecs go too, see content.go.
+		typed := false
+		if resource != "" && len(d.opts.Codecs) > 0 {
+			var derr error
+			if typed, derr = d.dropTyped(collection, resource, d.ext()); derr != nil {
+				return derr
+			}
+		}
+
+		if resource == "" || err != nil && !typed {
+			return fmt.Errorf("unable to find file or directory named %v: %w", filepath.Join(collection, resource), ErrNotFound)
+		}
+
+		if err == nil {
+			if err := d.io(func() error { return d.removeStored(record) }); err != nil {
+				return err
+			}
+		}
+	}
+
+	if resource != "" {
+		os.Remove(d.leasePath(collection, resource))
+	}
+
+	if resource == "" {
+		d.forgetUsage(collection)
+		d.forgetIndexes(collection)
+	} else {
+		d.releaseQuota(collection, freed)
+		d.reindex(collection, resource, nil)
+	}
+
+	d.cache.remove(collection, resource)
+	d.trace(OpDelete, collection, resource, 0)
+
+	return d.mirrorOp("delete", collection, resource, func(m *Driver) error {
+		if err := m.delete(collection, resource); !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// lockResource takes the lock guarding a single record and returns the
+// function releasing it. By default that is the collection lock; with
+// Options.ResourceLocks it is a shared hold on the collection lock plus the
+// record's own mutex, so writes to different records of one collection run
+// in parallel while collection-wide operations, which take the collection
+// lock exclusively, still exclude them all. An empty resource, or a
+// collection cap that a write may have to evict for, locks the whole
+// collection.
+func (d *Driver) lockResource(collection, resource string) func() {
+	if !d.opts.ResourceLocks || resource == "" || d.opts.MaxRecordsPerCollection > 0 {
+		return d.lockExclusive(collection, resource)
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+
+	d.mutex.Lock()
+	key := d.recordKey(collection, resource)
+	m, ok := d.resourceMutexes[key]
+	if !ok {
+		m = &resourceMutex{}
+		d.resourceMutexes[key] = m
+	}
+	m.users++
+	d.mutex.Unlock()
+
+	op := d.inflight.begin(collection, resource, true)
+	start := d.lockWaitStart()
+	mutex.RLock()
+	m.Lock()
+	d.recordLockWait(collection, start)
+	d.inflight.locked(op)
+
+	return func() {
+		m.Unlock()
+		mutex.RUnlock()
+
+		d.mutex.Lock()
+		if m.users--; m.users == 0 {
+			delete(d.resourceMutexes, key)
+		}
+		d.mutex.Unlock()
+
+		d.releaseMutex(collection)
+		d.inflight.end(op)
+	}
+}
+
+// resourceMutex is the lock of one record under Options.ResourceLocks,
+// dropped once nobody holds or waits for it so the map of them doesn't
+// grow with every record ever written. users is guarded by d.mutex.
+type resourceMutex struct {
+	sync.Mutex
+	users int
+}
+
+// lockCollection takes the collection lock exclusively and returns the
+// function releasing it.
+func (d *Driver) lockCollection(collection string) func() {
+	return d.lockExclusive(collection, "")
+}
+
+// lockExclusive is lockCollection on behalf of resource, as InFlight
+// reports it.
+func (d *Driver) lockExclusive(collection, resource string) func() {
+	mutex := d.getOrCreateMutex(collection)
+
+	op := d.inflight.begin(collection, resource, true)
+	start := d.lockWaitStart()
+	mutex.Lock()
+	d.recordLockWait(collection, start)
+	d.inflight.locked(op)
+
+	return func() {
+		mutex.Unlock()
+		d.releaseMutex(collection)
+		d.inflight.end(op)
+	}
+}
+
+// rlockCollection takes a shared hold on the collection lock and returns
+// the function releasing it.
+func (d *Driver) rlockCollection(collection string) func() {
+	mutex := d.getOrCreateMutex(collection)
+
+	op := d.inflight.begin(collection, "", false)
+	start := d.lockWaitStart()
+	mutex.RLock()
+	d.recordLockWait(collection, start)
+	d.inflight.locked(op)
+
+	return func() {
+		mutex.RUnlock()
+		d.releaseMutex(collection)
+		d.inflight.end(op)
+	}
+}
+
+// getOrCreateMutex returns the collection's lock and counts the caller as
+// a user of it until the matching releaseMutex, so Refresh never drops a
+// lock that is held or about to be.
+func (d *Driver) getOrCreateMutex(collection string) *sync.RWMutex {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	m, ok := d.mutexes[collection]
+
+	if !ok {
+		m = &sync.RWMutex{}
+		d.mutexes[collection] = m
+	}
+
+	d.mutexUsers[collection]++
+	return m
+}
+
+func (d *Driver) releaseMutex(collection string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.mutexUsers[collection]--; d.mutexUsers[collection] == 0 {
+		delete(d.mutexUsers, collection)
+	}
+}
@@ -0,0 +1,164 @@
+package godb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+)
+
+// An encrypted record file holds encryptedMagic, a random nonce and the
+// AES-GCM sealed record. Encryption happens just before a record reaches
+// disk and decryption right after it is read, so every other feature sees
+// plain JSON; the cache holds plaintext too.
+//
+// Files without the magic prefix are read as plain JSON even if their
+// collection has a key, so encryption can be switched on for an existing
+// collection; its records are encrypted as they are rewritten, e.g. by
+// Canonicalize. The reverse doesn't hold: reading an encrypted record
+// without its collection's key, or with the wrong one, fails with
+// ErrDecrypt. The key is chosen per collection, not per file, so rotating a
+// key means rewriting the collection, e.g. with CopyCollectionTo into a
+// driver holding the new key.
+//
+// Exploded storage splits records into per-field files and cannot be
+// combined with encryption.
+
+const encryptedMagic = "GODBENC1"
+
+type ciphers struct {
+	fallback    cipher.AEAD
+	collections map[string]cipher.AEAD
+}
+
+func newCiphers(opts Options) (*ciphers, error) {
+	if len(opts.EncryptionKey) == 0 && len(opts.CollectionKeys) == 0 {
+		return nil, nil
+	}
+
+	if opts.Exploded {
+		return nil, fmt.Errorf("Unable to encrypt records - exploded storage doesn't support encryption!")
+	}
+
+	c := &ciphers{collections: make(map[string]cipher.AEAD, len(opts.CollectionKeys))}
+
+	var err error
+	if len(opts.EncryptionKey) > 0 {
+		if c.fallback, err = newAEAD(opts.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("Invalid encryption key: %v", err)
+		}
+	}
+
+	for collection, key := range opts.CollectionKeys {
+		if c.collections[collection], err = newAEAD(key); err != nil {
+			return nil, fmt.Errorf("Invalid encryption key for collection '%s': %v", collection, err)
+		}
+	}
+
+	return c, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (c *ciphers) forCollection(collection string) cipher.AEAD {
+	if c == nil {
+		return nil
+	}
+
+	if aead, ok := c.collections[collection]; ok {
+		return aead
+	}
+
+	return c.fallback
+}
+
+// seal turns a record's bytes into what is stored on disk: it encrypts
+// the fields listed in Options.EncryptedFields, runs Options.WritePipeline,
+// then encrypts the whole record with the collection's key, if it has one
+// and no encrypted fields.
+func (d *Driver) seal(collection, resource string, b []byte) ([]byte, error) {
+	b, err := d.sealFields(collection, resource, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = d.runWritePipeline(collection, resource, b); err != nil {
+		return nil, err
+	}
+
+	aead := d.ciphers.forCollection(collection)
+	if aead == nil || len(d.opts.EncryptedFields[collection]) > 0 {
+		return b, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(encryptedMagic), nonce...)
+	return aead.Seal(out, nonce, b, nil), nil
+}
+
+// open undoes seal on a record's bytes as read from disk.
+func (d *Driver) open(collection, resource string, b []byte) ([]byte, error) {
+	b, err := d.decrypt(collection, resource, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = d.runReadPipeline(collection, resource, b); err != nil {
+		return nil, err
+	}
+
+	return d.openFields(collection, resource, b)
+}
+
+func (d *Driver) decrypt(collection, resource string, b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, []byte(encryptedMagic)) {
+		return b, nil
+	}
+
+	aead := d.ciphers.forCollection(collection)
+	if aead == nil {
+		return nil, fmt.Errorf("%w '%s' in '%s' - no key configured for the collection", ErrDecrypt, resource, collection)
+	}
+
+	b = b[len(encryptedMagic):]
+	if len(b) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w '%s' in '%s' - the file is truncated", ErrDecrypt, resource, collection)
+	}
+
+	plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s' in '%s' - wrong key or corrupt file", ErrDecrypt, resource, collection)
+	}
+
+	return plain, nil
+}
+
+// wholeRecord reports whether a record file's bytes look complete: valid
+// JSON, a valid chunk manifest, or an encrypted record long enough to hold
+// a nonce and GCM tag. Encrypted records can't be checked further without
+// their key.
+func wholeRecord(b []byte) bool {
+	if bytes.HasPrefix(b, []byte(encryptedMagic)) {
+		return len(b) >= len(encryptedMagic)+12+16
+	}
+
+	if bytes.HasPrefix(b, []byte(chunkMagic)) {
+		_, err := parseManifest("", b[len(chunkMagic):])
+		return err == nil
+	}
+
+	return json.Valid(b)
+}
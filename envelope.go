@@ -0,0 +1,157 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// With Options.UseEnvelope every record is stored wrapped with its
+// metadata,
+//
+//	{"_meta": {"version":3,"createdAt":"...","updatedAt":"..."},
+//	"_data": <the record>}
+//
+// and every read unwraps "_data" first, so beyond ReadMeta the envelope is
+// invisible: Read, ReadAll, ForEach, the cache and the rest see the record
+// itself. Per-record metadata belongs in Meta, not in files beside the
+// record.
+//
+// Turning the option on needs no migration: records stored bare read as
+// before, ReadMeta gives them a zero Meta, and each gets its envelope the
+// next time it's written - to wrap a whole collection at once, read every
+// record and write it back. Turning it off again is the reverse: the
+// driver without it reads "_meta" and "_data" as the record's own fields,
+// so copy the records out through a driver that has the option before
+// dropping it. Envelopes need JSON records, and ConvertCollection
+// refuses to run with them.
+
+// Meta is a record's metadata under Options.UseEnvelope.
+type Meta struct {
+	// Version counts the writes of the record, starting at 1.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type envelope struct {
+	Meta *Meta           `json:"_meta"`
+	Data json.RawMessage `json:"_data"`
+}
+
+func checkEnvelope(opts Options) error {
+	if _, ok := opts.Codec.(JSONCodec); opts.UseEnvelope && !ok {
+		return fmt.Errorf("Invalid codec - UseEnvelope needs JSON records!")
+	}
+	return nil
+}
+
+// splitEnvelope returns an enveloped record's metadata and record, or false
+// for a bare record.
+func splitEnvelope(b []byte) (Meta, []byte, bool) {
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil || env.Meta == nil || env.Data == nil {
+		return Meta{}, nil, false
+	}
+	return *env.Meta, env.Data, true
+}
+
+// unwrap returns the record held by stored bytes.
+func (d *Driver) unwrap(b []byte) []byte {
+	if !d.opts.UseEnvelope {
+		return b
+	}
+
+	if _, data, ok := splitEnvelope(b); ok {
+		return d.terminate(data)
+	}
+
+	return b
+}
+
+// wrap envelops record b with meta. The record's bytes are kept as they
+// are, so unwrap gives them back unchanged.
+func (d *Driver) wrap(meta Meta, b []byte) ([]byte, error) {
+	m, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"_meta": `)
+	buf.Write(m)
+	buf.WriteString(",\n\"_data\": ")
+	buf.Write(bytes.TrimRight(b, "\n"))
+	buf.WriteString("}")
+
+	return d.terminate(buf.Bytes()), nil
+}
+
+// newMeta is the metadata of a record's first write.
+func (d *Driver) newMeta() Meta {
+	now := d.opts.Clock().UTC()
+	return Meta{1, now, now}
+}
+
+// envelop wraps b for writing over the stored record, bumping its version
+// and keeping its creation time; the caller must hold the record's lock.
+func (d *Driver) envelop(collection, resource string, b []byte) ([]byte, error) {
+	var old []byte
+	err := d.io(func() (err error) {
+		old, err = d.loadVersion(collection, resource)
+		return err
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	meta, _, ok := splitEnvelope(old)
+	if !ok {
+		return d.wrap(d.newMeta(), b)
+	}
+
+	meta.Version++
+	meta.UpdatedAt = d.opts.Clock().UTC()
+	return d.wrap(meta, b)
+}
+
+// ReadMeta returns the metadata of a record stored with Options.UseEnvelope.
+// A record stored bare, or any record without the option, has a zero Meta.
+func (d *Driver) ReadMeta(collection, resource string) (Meta, error) {
+	if collection == "" {
+		return Meta{}, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return Meta{}, fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return Meta{}, err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return Meta{}, err
+	}
+
+	var b []byte
+	err := d.io(func() (err error) {
+		b, err = d.loadVersion(collection, resource)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return Meta{}, ErrNotFound
+	}
+	if err != nil {
+		return Meta{}, err
+	}
+
+	if !d.opts.UseEnvelope {
+		return Meta{}, nil
+	}
+
+	meta, _, _ := splitEnvelope(b)
+	return meta, nil
+}
@@ -0,0 +1,31 @@
+package godb
+
+import "errors"
+
+var (
+	ErrInvalidName        = errors.New("invalid name")
+	ErrNotFound           = errors.New("record not found")
+	ErrLocked             = errors.New("database is locked by another process")
+	ErrConditionFailed    = errors.New("write condition not met")
+	ErrPatchTestFailed    = errors.New("JSON patch test operation failed")
+	ErrTimeout            = errors.New("disk operation timed out")
+	ErrCorruptRecord      = errors.New("record is corrupt")
+	ErrNoSpace            = errors.New("no space left on device")
+	ErrReadOnlyFS         = errors.New("read-only file system")
+	ErrRoundTripMismatch  = errors.New("value does not survive a JSON round trip")
+	ErrStale              = errors.New("record is older than allowed")
+	ErrEmpty              = errors.New("collection is empty")
+	ErrNotLeased          = errors.New("lease not held")
+	ErrFrozen             = errors.New("collection is frozen")
+	ErrCollectionExists   = errors.New("collection already exists")
+	ErrNotWritable        = errors.New("database directory is not writable")
+	ErrDecrypt            = errors.New("unable to decrypt record")
+	ErrSchemaViolation    = errors.New("record violates the collection schema")
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrNotDatabase        = errors.New("directory doesn't look like a database")
+	ErrClosed             = errors.New("driver is closed")
+	ErrFenced             = errors.New("driver was fenced by a newer one")
+	ErrQuotaExceeded      = errors.New("collection quota exceeded")
+	ErrRecordExists       = errors.New("record already exists")
+	ErrUnauthorized       = errors.New("operation not authorized")
+)
@@ -0,0 +1,120 @@
+package godb
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// eventBuffer is the number of events a subscriber can fall behind by
+// before further events to it are dropped.
+const eventBuffer = 64
+
+// Event reports a change made through the driver. Per-event delivery fills
+// Op and Resource; Resource is empty for changes to a whole collection.
+// With Options.EventBatchWindow set, an Event instead stands for every
+// change to Collection within one window and lists the changed resources
+// in Resources, sorted and without duplicates, with Op and Resource left
+// empty; an empty name in Resources stands for the whole collection.
+type Event struct {
+	Op         string
+	Collection string
+	Resource   string
+	Resources  []string
+}
+
+type eventHub struct {
+	mu      sync.Mutex
+	window  time.Duration
+	subs    map[chan Event]string
+	pending map[string]map[string]bool
+}
+
+func newEventHub(window time.Duration) *eventHub {
+	return &eventHub{
+		window:  window,
+		subs:    make(map[chan Event]string),
+		pending: make(map[string]map[string]bool),
+	}
+}
+
+// Subscribe returns a channel receiving an Event for every change to
+// collection, or to any collection when collection is empty, and a function
+// that ends the subscription and closes the channel. Events are delivered
+// without blocking the operation that caused them: a subscriber more than
+// eventBuffer events behind misses the events that don't fit and should
+// re-read what it cares about. Changes made by other processes are not
+// reported.
+func (d *Driver) Subscribe(collection string) (<-chan Event, func()) {
+	h := d.events
+	ch := make(chan Event, eventBuffer)
+
+	h.mu.Lock()
+	h.subs[ch] = collection
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish reports a change to subscribers, directly or as part of the
+// collection's next batch.
+func (h *eventHub) publish(op, collection, resource string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs) == 0 {
+		return
+	}
+
+	if h.window <= 0 {
+		h.send(Event{Op: op, Collection: collection, Resource: resource})
+		return
+	}
+
+	batch, ok := h.pending[collection]
+	if !ok {
+		batch = make(map[string]bool)
+		h.pending[collection] = batch
+		time.AfterFunc(h.window, func() { h.flush(collection) })
+	}
+	batch[resource] = true
+}
+
+// flush delivers the batch collected for collection.
+func (h *eventHub) flush(collection string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	batch := h.pending[collection]
+	delete(h.pending, collection)
+
+	resources := make([]string, 0, len(batch))
+	for resource := range batch {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	h.send(Event{Collection: collection, Resources: resources})
+}
+
+// send delivers e to every matching subscriber; h.mu must be held.
+func (h *eventHub) send(e Event) {
+	for ch, collection := range h.subs {
+		if collection != "" && collection != e.Collection {
+			continue
+		}
+
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
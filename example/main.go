@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	godb "github.com/kamoellen/go-database"
+)
+
+type Address struct {
+	City    string
+	State   string
+	Country string
+	Pincode json.Number
+}
+
+type User struct {
+	Name    string
+	Age     json.Number
+	Contact string
+	Company string
+	Address Address
+}
+
+func main() {
+	dir := "./Users" // make n add .json
+
+	db, err := godb.New(dir, nil)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	employees := []User{
+		{Name: "Kamo", Age: "23", Contact: "23344333", Company: "RemoteKamo", Address: Address{City: "Pretoria", State: "Central", Country: "South Africa", Pincode: "410013"}},
+		{Name: "Kamzo", Age: "25", Contact: "23344333", Company: "RemoteKamzo", Address: Address{City: "Cape Town", State: "Central", Country: "South Africa", Pincode: "410013"}},
+		{Name: "Kamogelo", Age: "27", Contact: "23344333", Company: "RemoteKamogelo", Address: Address{City: "Durban", State: "Central", Country: "South Africa", Pincode: "410013"}},
+		{Name: "El", Age: "29", Contact: "23344333", Company: "RemoteEL", Address: Address{City: "Pretoria", State: "Central", Country: "South Africa", Pincode: "410013"}},
+		{Name: "Ellie", Age: "31", Contact: "23344333", Company: "RemoteEllie", Address: Address{City: "Pretoria", State: "Central", Country: "South Africa", Pincode: "410013"}},
+		{Name: "Ellen", Age: "32", Contact: "23344333", Company: "RemoteEllen", Address: Address{City: "Pretoria", State: "Central", Country: "South Africa", Pincode: "410013"}},
+	}
+
+	// Seed writes the employees on the first run only.
+	err = db.Seed(func(db *godb.Driver) error {
+		for _, value := range employees {
+			if err := db.Write("users", value.Name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error writing user data:", err)
+	}
+
+	var users []User
+	if err := db.ReadAll("users", &users); err != nil {
+		fmt.Println("Error reading user data:", err)
+		return
+	}
+	fmt.Println("Records:", users)
+
+	fmt.Println("All Users:")
+	for _, user := range users {
+		fmt.Printf("%+v\n", user)
+	}
+
+	// Optionally delete a user
+	if err := db.Delete("users", "John"); err != nil {
+		fmt.Println("Error deleting user data:", err)
+	}
+}
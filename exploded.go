@@ -0,0 +1,126 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exploded storage keeps each record as a directory,
+// "<collection>/<resource>/", holding one "<field>.json" file per top-level
+// field. A single field can then be read, grepped or edited on disk without
+// touching the rest of the record.
+//
+// The trade-offs: only records that marshal to a JSON object can be stored;
+// every record costs a directory plus one inode per field; reads open one
+// file per field, so they are slower; and a write replaces the whole record
+// directory - it is built under a hidden temp name and renamed into place,
+// with the previous directory moved aside first, so readers can briefly find
+// the record missing but never see a mix of old and new fields.
+
+func (d *Driver) explodedDir(collection, resource string) string {
+	return filepath.Join(d.collectionDir(collection), d.encodeResource(resource))
+}
+
+// fieldFile maps a field name to a safe file name; leading dots are escaped
+// so fields never become hidden files or "." and "..".
+func fieldFile(field string) string {
+	name := url.PathEscape(field)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+
+	return name + ".json"
+}
+
+func (d *Driver) writeExploded(dir string, b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return fmt.Errorf("Exploded storage requires a JSON object: %v", err)
+	}
+
+	parent, base := filepath.Dir(dir), filepath.Base(dir)
+	tmp := filepath.Join(parent, "."+base+".tmp")
+	old := filepath.Join(parent, "."+base+".old")
+
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+
+	if err := d.mkdirAll(tmp); err != nil {
+		return err
+	}
+	d.countTemp()
+
+	for field, raw := range fields {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "\t"); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+
+		data := d.terminate(buf.Bytes())
+		if err := ioutil.WriteFile(filepath.Join(tmp, fieldFile(field)), data, 0644); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		d.countWrite(len(data))
+	}
+
+	switch err := os.Rename(dir, old); {
+	case err == nil:
+		d.countRename()
+	case !os.IsNotExist(err):
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		os.Rename(old, dir)
+		return err
+	}
+	d.countRename()
+
+	return os.RemoveAll(old)
+}
+
+// readExploded reassembles a record directory into one JSON object.
+func (d *Driver) readExploded(dir string) ([]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]json.RawMessage, len(files))
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		field, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid field file '%s': %v", name, err)
+		}
+
+		raw, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		d.countRead(len(raw))
+		fields[field] = bytes.TrimSpace(raw)
+	}
+
+	b, err := json.MarshalIndent(fields, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.terminate(b), nil
+}
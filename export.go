@@ -0,0 +1,168 @@
+package godb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportAll streams the whole database to w as a single JSON object mapping
+// collection names to objects of resource name to record, reading one
+// record at a time. Each collection is read as ForEach does, so the dump is
+// consistent per record but not across the database.
+func (d *Driver) ExportAll(w io.Writer) error {
+	collections, err := d.collections()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+
+	for i, collection := range collections {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+
+		name, _ := json.Marshal(collection)
+		bw.Write(name)
+		bw.WriteString(":{")
+
+		first := true
+		err := d.ForEach(collection, func(resource string, data []byte) error {
+			if !first {
+				bw.WriteByte(',')
+			}
+			first = false
+
+			name, _ := json.Marshal(resource)
+			bw.Write(name)
+			bw.WriteByte(':')
+
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, data); err != nil {
+				return fmt.Errorf("Unable to export '%s' in '%s': %w", resource, collection, err)
+			}
+			_, err := bw.Write(buf.Bytes())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		bw.WriteByte('}')
+	}
+
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+// ImportAll loads a dump produced by ExportAll, writing every record with
+// Write and so creating collections as needed. The input is decoded one
+// record at a time. Records already written stay in place if a later one
+// fails.
+func (d *Driver) ImportAll(r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		collection, err := stringToken(dec)
+		if err != nil {
+			return err
+		}
+
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+
+		for dec.More() {
+			resource, err := stringToken(dec)
+			if err != nil {
+				return err
+			}
+
+			var record json.RawMessage
+			if err := dec.Decode(&record); err != nil {
+				return fmt.Errorf("Unable to import '%s' in '%s': %w", resource, collection, err)
+			}
+
+			if err := d.Write(collection, resource, record); err != nil {
+				return err
+			}
+		}
+
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if tok != want {
+		return fmt.Errorf("Invalid dump - expected '%v', got '%v'!", want, tok)
+	}
+
+	return nil
+}
+
+func stringToken(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("Invalid dump - expected a name, got '%v'!", tok)
+	}
+
+	return s, nil
+}
+
+// CopyCollectionTo copies every record of collection into the collection of
+// the same name in dst, overwriting records dst already has, and returns
+// the number copied. Records are read as ForEach does and stored byte for
+// byte, bypassing dst's encoding, so any record survives the copy whatever
+// its type. Records dst has but d lacks are left alone.
+func (d *Driver) CopyCollectionTo(collection string, dst *Driver) (int, error) {
+	if dst == nil {
+		return 0, fmt.Errorf("Missing destination - no place to copy collection '%s' to!", collection)
+	}
+
+	n := 0
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		if err := dst.checkWrite(collection, resource); err != nil {
+			return err
+		}
+
+		unlock := dst.lockResource(collection, resource)
+		defer unlock()
+
+		if dst.opts.MaxRecordsPerCollection > 0 {
+			if err := dst.makeRoom(collection, resource); err != nil {
+				return err
+			}
+		}
+
+		if err := dst.writeRecord(collection, resource, data); err != nil {
+			return fmt.Errorf("Unable to copy '%s' in '%s': %w", resource, collection, err)
+		}
+
+		n++
+		return nil
+	})
+
+	return n, err
+}
@@ -0,0 +1,225 @@
+package godb
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// A collection listed in Options.EncryptedFields keeps its records in
+// plain JSON on disk except for the values at the listed paths, each of
+// which is replaced by an object holding a single "$godbenc" string: the
+// base64 (standard, padded) of a random nonce followed by the AES-GCM
+// sealed bytes of the value, exactly as they appeared in the record, with
+// the field path as additional data so a value can't be moved to another
+// field unnoticed. For example
+//
+//	"contact": {"$godbenc": "q8Jx...Zw=="}
+//
+// Values are sealed just before the write pipeline and opened right after
+// the read pipeline, so every method - Read, ReadAll, ForEach, Select,
+// queries on the encrypted fields themselves - sees the plaintext, as does
+// the cache; only tools reading the files directly see ciphertext. Records
+// of these collections are never encrypted whole.
+//
+// The key is the collection's key from Options.CollectionKeys, or
+// EncryptionKey, and New fails without one. Keys are managed as for
+// whole-record encryption (see encryption.go): values stay readable only
+// with the key they were sealed with, so rotating it means rewriting the
+// collection. Values left in plaintext, e.g. written before the field was
+// listed, are read as they are and sealed when the record is rewritten.
+//
+// Paths are dotted through nested objects ("contact.email"); a path whose
+// field is missing, or that runs into something other than an object, is
+// skipped. Fields inside arrays can't be listed. With Options.UseEnvelope
+// paths are relative to the record, not the envelope.
+
+const encryptedFieldKey = "$godbenc"
+
+func checkEncryptedFields(opts Options, c *ciphers) error {
+	for collection, paths := range opts.EncryptedFields {
+		if c.forCollection(collection) == nil {
+			return fmt.Errorf("Unable to encrypt fields of '%s' - no key configured for the collection!", collection)
+		}
+
+		for _, path := range paths {
+			if !dottedPath(path) {
+				return fmt.Errorf("Invalid encrypted field %q of '%s' - paths are dotted field names!", path, collection)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dottedPath reports whether path names fields as Project does.
+func dottedPath(path string) bool {
+	return path != "" && !strings.HasPrefix(path, ".") && !strings.HasSuffix(path, ".") && !strings.Contains(path, "..")
+}
+
+// fieldSpan locates a field's value in a record's bytes.
+type fieldSpan struct {
+	path       string
+	start, end int
+}
+
+// fieldSpans finds the values of the fields of collection's records listed
+// in Options.EncryptedFields, in the order they appear in b.
+func (d *Driver) fieldSpans(collection string, b []byte) ([]fieldSpan, error) {
+	want := make(map[string]string)
+	for _, path := range d.opts.EncryptedFields[collection] {
+		want[path] = path
+		if d.opts.UseEnvelope {
+			want["_data."+path] = path
+		}
+	}
+
+	var spans []fieldSpan
+	err := findSpans(b, 0, "", want, &spans)
+	return spans, err
+}
+
+func findSpans(b []byte, base int, prefix string, want map[string]string, spans *[]fieldSpan) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		end := int(dec.InputOffset())
+		start := end - len(raw)
+		path := joinPath(prefix, tok.(string))
+
+		if field, ok := want[path]; ok {
+			*spans = append(*spans, fieldSpan{field, base + start, base + end})
+			continue
+		}
+
+		for wanted := range want {
+			if strings.HasPrefix(wanted, path+".") {
+				if err := findSpans(raw, base+start, path, want, spans); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// spliceFields replaces each span of b by what fn makes of its value.
+func spliceFields(b []byte, spans []fieldSpan, fn func(path string, value []byte) ([]byte, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	last := 0
+
+	for _, span := range spans {
+		value, err := fn(span.path, b[span.start:span.end])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(b[last:span.start])
+		buf.Write(value)
+		last = span.end
+	}
+	buf.Write(b[last:])
+
+	return buf.Bytes(), nil
+}
+
+// sealFields encrypts the listed fields of a record of collection.
+func (d *Driver) sealFields(collection, resource string, b []byte) ([]byte, error) {
+	if len(d.opts.EncryptedFields[collection]) == 0 {
+		return b, nil
+	}
+
+	spans, err := d.fieldSpans(collection, b)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encrypt fields of '%s' in '%s': %w", resource, collection, err)
+	}
+
+	aead := d.ciphers.forCollection(collection)
+
+	return spliceFields(b, spans, func(path string, value []byte) ([]byte, error) {
+		if _, ok := sealedField(value); ok {
+			return value, nil
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		sealed := aead.Seal(nonce, nonce, value, []byte(path))
+		return json.Marshal(map[string]string{encryptedFieldKey: base64.StdEncoding.EncodeToString(sealed)})
+	})
+}
+
+// openFields decrypts the listed fields of a record of collection. A record
+// that isn't valid JSON is returned as is, for the caller to report.
+func (d *Driver) openFields(collection, resource string, b []byte) ([]byte, error) {
+	if len(d.opts.EncryptedFields[collection]) == 0 {
+		return b, nil
+	}
+
+	spans, err := d.fieldSpans(collection, b)
+	if err != nil {
+		return b, nil
+	}
+
+	aead := d.ciphers.forCollection(collection)
+
+	return spliceFields(b, spans, func(path string, value []byte) ([]byte, error) {
+		sealed, ok := sealedField(value)
+		if !ok {
+			return value, nil
+		}
+
+		return openField(aead, path, sealed, resource, collection)
+	})
+}
+
+// sealedField returns the ciphertext held by an encrypted field value.
+func sealedField(value []byte) ([]byte, bool) {
+	var obj map[string]string
+	if json.Unmarshal(value, &obj) != nil || len(obj) != 1 {
+		return nil, false
+	}
+
+	enc, ok := obj[encryptedFieldKey]
+	if !ok {
+		return nil, false
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(enc)
+	return sealed, err == nil
+}
+
+func openField(aead cipher.AEAD, path string, sealed []byte, resource, collection string) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w '%s' in '%s' - field '%s' is truncated", ErrDecrypt, resource, collection, path)
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s' in '%s' - wrong key or corrupt field '%s'", ErrDecrypt, resource, collection, path)
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,125 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GetField returns the value at a dotted path, such as "address.city", in a
+// record, decoded like Project's values: numbers come back as json.Number,
+// objects as map[string]interface{}.
+func (d *Driver) GetField(collection, resource, path string) (interface{}, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return nil, err
+	}
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := lookupField(doc, path)
+	if !ok {
+		return nil, fmt.Errorf("Field '%s' not found in '%s'!", path, resource)
+	}
+
+	return v, nil
+}
+
+// SetField sets the value at a dotted path in a record under the record's
+// lock, creating missing objects along the way. It fails if the path runs
+// into a value that isn't an object. Like MergePatch, it writes byte-stable
+// output and skips updates that change nothing.
+func (d *Driver) SetField(collection, resource, path string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	v, err := decodeDocument(b)
+	if err != nil {
+		return err
+	}
+
+	return d.updateField(collection, resource, path, func(obj map[string]interface{}, key string) {
+		obj[key] = v
+	})
+}
+
+// DeleteField removes the value at a dotted path from a record under the
+// record's lock. Deleting a field the record doesn't have is a no-op.
+func (d *Driver) DeleteField(collection, resource, path string) error {
+	return d.updateField(collection, resource, path, func(obj map[string]interface{}, key string) {
+		delete(obj, key)
+	})
+}
+
+// updateField applies fn to the object holding the last key of path.
+func (d *Driver) updateField(collection, resource, path string, fn func(obj map[string]interface{}, key string)) error {
+	if path == "" {
+		return fmt.Errorf("Missing field - unable to update record!")
+	}
+
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return err
+	}
+
+	updated := deepCopy(doc)
+
+	obj, ok := updated.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Unable to update field '%s' - '%s' is not an object!", path, resource)
+	}
+
+	keys := strings.Split(path, ".")
+	for i, key := range keys[:len(keys)-1] {
+		next, exists := obj[key]
+		if !exists {
+			next = make(map[string]interface{})
+			obj[key] = next
+		}
+
+		if obj, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("Unable to update field '%s' - '%s' is not an object!", path, strings.Join(keys[:i+1], "."))
+		}
+	}
+
+	fn(obj, keys[len(keys)-1])
+
+	if jsonEqual(updated, doc) {
+		return nil
+	}
+
+	return d.write(collection, resource, updated)
+}
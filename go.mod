@@ -1,5 +1,5 @@
 module github.com/kamoellen/go-database
 
-go 1.16
+go 1.18
 
 require github.com/jcelliott/lumber v0.0.0-20160324203708-dd349441af25
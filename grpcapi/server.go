@@ -0,0 +1,134 @@
+// Package grpcapi serves a godb database over gRPC; see godbpb/godb.proto
+// for the service definition. It is a separate module so that users of the
+// core package don't pull in the gRPC dependency.
+package grpcapi
+
+//go:generate protoc -I godbpb --go_out=godbpb --go_opt=paths=source_relative --go-grpc_out=godbpb --go-grpc_opt=paths=source_relative godb.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+
+	godb "github.com/kamoellen/go-database"
+	"github.com/kamoellen/go-database/grpcapi/godbpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type server struct {
+	godbpb.UnimplementedDatabaseServer
+	d *godb.Driver
+}
+
+// NewServer returns a godbpb.DatabaseServer delegating to d, to register
+// with godbpb.RegisterDatabaseServer. Missing records and collections fail
+// with codes.NotFound, empty or invalid names and invalid JSON with
+// codes.InvalidArgument.
+func NewServer(d *godb.Driver) godbpb.DatabaseServer {
+	return &server{d: d}
+}
+
+func (s *server) Write(ctx context.Context, req *godbpb.WriteRequest) (*godbpb.WriteResponse, error) {
+	if err := requireNames(req.Collection, req.Resource); err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(req.Data) {
+		return nil, status.Error(codes.InvalidArgument, "data is not valid JSON")
+	}
+
+	if err := s.d.Write(req.Collection, req.Resource, json.RawMessage(req.Data)); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &godbpb.WriteResponse{}, nil
+}
+
+func (s *server) Read(ctx context.Context, req *godbpb.ReadRequest) (*godbpb.ReadResponse, error) {
+	if err := requireNames(req.Collection, req.Resource); err != nil {
+		return nil, err
+	}
+
+	var record json.RawMessage
+	if err := s.d.Read(req.Collection, req.Resource, &record); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &godbpb.ReadResponse{Data: record}, nil
+}
+
+func (s *server) ReadAll(ctx context.Context, req *godbpb.ReadAllRequest) (*godbpb.ReadAllResponse, error) {
+	if err := requireNames(req.Collection); err != nil {
+		return nil, err
+	}
+
+	var records []*godbpb.Record
+
+	err := s.d.ForEach(req.Collection, func(resource string, data []byte) error {
+		records = append(records, &godbpb.Record{Resource: resource, Data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &godbpb.ReadAllResponse{Records: records}, nil
+}
+
+func (s *server) Delete(ctx context.Context, req *godbpb.DeleteRequest) (*godbpb.DeleteResponse, error) {
+	if err := requireNames(req.Collection, req.Resource); err != nil {
+		return nil, err
+	}
+
+	if err := s.d.Delete(req.Collection, req.Resource); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &godbpb.DeleteResponse{}, nil
+}
+
+func (s *server) Query(ctx context.Context, req *godbpb.QueryRequest) (*godbpb.QueryResponse, error) {
+	if err := requireNames(req.Collection); err != nil {
+		return nil, err
+	}
+
+	matches, err := s.d.ReadPrefix(req.Collection, req.Prefix)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	records := make([]*godbpb.Record, 0, len(matches))
+	for resource, data := range matches {
+		records = append(records, &godbpb.Record{Resource: resource, Data: data})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Resource < records[j].Resource })
+
+	return &godbpb.QueryResponse{Records: records}, nil
+}
+
+// requireNames rejects empty names up front; the driver reports those with
+// plain errors that toStatus couldn't tell apart from internal failures.
+func requireNames(names ...string) error {
+	for _, name := range names {
+		if name == "" {
+			return status.Error(codes.InvalidArgument, "collection and resource names must not be empty")
+		}
+	}
+	return nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, godb.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, godb.ErrNotFound.Error())
+	case errors.Is(err, godb.ErrInvalidName):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, godb.ErrTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
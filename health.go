@@ -0,0 +1,39 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Healthy reports whether the database directory exists and is writable,
+// by creating and removing a tiny temp file in it. It never reads any
+// records, so it's cheap enough for a readiness probe.
+func (d *Driver) Healthy() error {
+	fi, err := os.Stat(d.dir)
+	if err != nil {
+		return fmt.Errorf("Database directory '%s' is not accessible: %w", d.dir, err)
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("Database path '%s' is not a directory!", d.dir)
+	}
+
+	f, err := ioutil.TempFile(d.dir, ".probe-*.tmp")
+	if err != nil {
+		return fmt.Errorf("Database directory '%s' is not writable: %w", d.dir, classifyIOError(err))
+	}
+
+	name := f.Name()
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(name)
+
+	if err != nil {
+		return fmt.Errorf("Database directory '%s' is not writable: %w", d.dir, classifyIOError(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package httpapi exposes a godb database as a REST API.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	godb "github.com/kamoellen/go-database"
+)
+
+// Handler serves d over HTTP:
+//
+//	GET    /{collection}             all records, as an object keyed by resource
+//	GET    /{collection}/{resource}  Read
+//	PUT    /{collection}/{resource}  Write; the body is the record's JSON
+//	DELETE /{collection}/{resource}  Delete
+//
+// Missing records and collections answer 404; invalid names and bodies,
+// including records the collection schema refuses, 400; calls
+// Options.Authorize refuses 403; and any other driver error 500. Collections can't be deleted over HTTP.
+func Handler(d *godb.Driver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if parts[0] == "" || len(parts) > 2 {
+			http.NotFound(w, r)
+			return
+		}
+
+		collection := parts[0]
+
+		if len(parts) == 1 {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", http.MethodGet)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			records, err := d.ReadAllRawMap(collection)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+
+			writeJSON(w, records)
+			return
+		}
+
+		resource := parts[1]
+
+		switch r.Method {
+		case http.MethodGet:
+			var record json.RawMessage
+			if err := d.Read(collection, resource, &record); err != nil {
+				writeError(w, err)
+				return
+			}
+
+			writeJSON(w, record)
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if !json.Valid(body) {
+				http.Error(w, "request body is not valid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := d.Write(collection, resource, json.RawMessage(body)); err != nil {
+				writeError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if err := d.Delete(collection, resource); err != nil {
+				writeError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, godb.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		http.Error(w, godb.ErrNotFound.Error(), http.StatusNotFound)
+	case errors.Is(err, godb.ErrInvalidName), errors.Is(err, godb.ErrSchemaViolation),
+		errors.Is(err, godb.ErrRoundTripMismatch), errors.Is(err, godb.ErrConditionFailed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, godb.ErrUnauthorized):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	godb "github.com/kamoellen/go-database"
+)
+
+func newServer(t *testing.T, opts *godb.Options) *httptest.Server {
+	t.Helper()
+
+	db, err := godb.New(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(db))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestHandlerRoundTrip(t *testing.T) {
+	srv := newServer(t, nil)
+
+	if code, _ := do(t, http.MethodPut, srv.URL+"/users/kamo", `{"name":"Kamo"}`); code != http.StatusNoContent {
+		t.Fatalf("PUT = %d, want %d", code, http.StatusNoContent)
+	}
+
+	if code, body := do(t, http.MethodGet, srv.URL+"/users/kamo", ""); code != http.StatusOK || body != `{"name":"Kamo"}` {
+		t.Fatalf("GET = %d %s", code, body)
+	}
+
+	if code, body := do(t, http.MethodGet, srv.URL+"/users", ""); code != http.StatusOK || body != `{"kamo":{"name":"Kamo"}}` {
+		t.Fatalf("GET collection = %d %s", code, body)
+	}
+
+	if code, _ := do(t, http.MethodDelete, srv.URL+"/users/kamo", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d, want %d", code, http.StatusNoContent)
+	}
+
+	if code, _ := do(t, http.MethodGet, srv.URL+"/users/kamo", ""); code != http.StatusNotFound {
+		t.Fatalf("GET after DELETE = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerStatusCodes(t *testing.T) {
+	srv := newServer(t, &godb.Options{
+		Authorize: func(op godb.Operation, collection, resource string) error {
+			if collection == "secrets" {
+				return errors.New("no access")
+			}
+			return nil
+		},
+	})
+
+	if code, _ := do(t, http.MethodPut, srv.URL+"/users/kamo", `{"age":`); code != http.StatusBadRequest {
+		t.Errorf("PUT of invalid JSON = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := do(t, http.MethodPut, srv.URL+"/users/.config", `{}`); code != http.StatusBadRequest {
+		t.Errorf("PUT to an invalid name = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := do(t, http.MethodGet, srv.URL+"/users/ghost", ""); code != http.StatusNotFound {
+		t.Errorf("GET of a missing record = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := do(t, http.MethodGet, srv.URL+"/", ""); code != http.StatusNotFound {
+		t.Errorf("GET / = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := do(t, http.MethodGet, srv.URL+"/secrets/key", ""); code != http.StatusForbidden {
+		t.Errorf("GET refused by Authorize = %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := do(t, http.MethodPost, srv.URL+"/users/kamo", `{}`); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST to a record = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+	if code, _ := do(t, http.MethodDelete, srv.URL+"/users", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE of a collection = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandlerSchemaViolation(t *testing.T) {
+	db, err := godb.New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := &godb.Schema{Type: "object", Required: []string{"name"}}
+	if err := db.ConfigureCollection("users", godb.CollectionConfig{Schema: schema}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(db))
+	defer srv.Close()
+
+	if code, _ := do(t, http.MethodPut, srv.URL+"/users/kamo", `{"age":3}`); code != http.StatusBadRequest {
+		t.Fatalf("PUT violating the schema = %d, want %d", code, http.StatusBadRequest)
+	}
+}
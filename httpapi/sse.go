@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	godb "github.com/kamoellen/go-database"
+)
+
+// sseEvent is the data of one server-sent event.
+type sseEvent struct {
+	Op        string          `json:"op,omitempty"`
+	Resource  string          `json:"resource,omitempty"`
+	Resources []string        `json:"resources,omitempty"`
+	Record    json.RawMessage `json:"record,omitempty"`
+}
+
+// SSEHandler streams the changes to collection, as reported by
+// Driver.Subscribe, as server-sent events, so a browser can follow them
+// with an EventSource. Each event is named after its operation ("write",
+// "delete", ...) and carries a JSON object with "op" and "resource"; write
+// events also carry the record's new content as "record", read when the
+// event is sent, and left out if the record is gone by then. With
+// Options.EventBatchWindow set, events are named "batch" and list the
+// changed resources in "resources" instead, without content. Like
+// Subscribe, only changes made through d are reported, and a client that
+// falls far behind misses events. The subscription ends when the client
+// disconnects.
+func SSEHandler(d *godb.Driver, collection string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		events, cancel := d.Subscribe(collection)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+
+				name := ev.Op
+				data := sseEvent{Op: ev.Op, Resource: ev.Resource, Resources: ev.Resources}
+
+				if name == "" {
+					name = "batch"
+				}
+
+				if ev.Op == godb.OpWrite && ev.Resource != "" {
+					var record json.RawMessage
+					if err := d.Read(ev.Collection, ev.Resource, &record); err == nil {
+						data.Record = record
+					}
+				}
+
+				b, err := json.Marshal(data)
+				if err != nil {
+					return
+				}
+
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
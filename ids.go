@@ -0,0 +1,101 @@
+package godb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// lastULID is the latest ULID made in this process, so the next one can be
+// made to sort after it.
+var lastULID struct {
+	mu sync.Mutex
+	id [16]byte
+}
+
+// NewULID returns a 26 character ULID: a 48-bit millisecond timestamp
+// followed by 80 random bits, Crockford base32 encoded. ULIDs made by one
+// process are monotonic: one made in the same millisecond as the previous,
+// or while the clock stands behind it, is the previous plus one, so they
+// always sort in creation order, which keeps Insert'ed records in
+// insertion order on disk. ULIDs from different processes only sort in
+// creation order across milliseconds.
+func NewULID() string {
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	var id [16]byte
+
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(id[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	lastULID.mu.Lock()
+	if string(id[:6]) <= string(lastULID.id[:6]) {
+		// Incrementing all 128 bits carries a full random part over into
+		// the timestamp, which only moves a millisecond ahead.
+		id = lastULID.id
+		for i := len(id) - 1; i >= 0; i-- {
+			if id[i]++; id[i] != 0 {
+				break
+			}
+		}
+	}
+	lastULID.id = id
+	lastULID.mu.Unlock()
+
+	// 128 bits encode to 26 base32 characters; the first character only
+	// carries the top 3 bits.
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[0:])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out[:])
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() string {
+	var id [16]byte
+
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// Insert writes v under a freshly generated resource name and returns it.
+// Names come from Options.IDGenerator, which defaults to NewULID. Insert
+// never overwrites: if the generated name is taken it fails with
+// ErrRecordExists and leaves the record alone.
+func (d *Driver) Insert(collection string, v interface{}) (string, error) {
+	resource := d.opts.IDGenerator()
+
+	written, err := d.WriteIfAbsent(collection, resource, v)
+	if err != nil {
+		return "", err
+	}
+
+	if !written {
+		return "", fmt.Errorf("Unable to insert '%s' into '%s': %w", resource, collection, ErrRecordExists)
+	}
+
+	return resource, nil
+}
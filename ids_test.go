@@ -0,0 +1,57 @@
+package godb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestULIDsAreMonotonic(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	prev := newULID(now)
+	for i := 0; i < 1000; i++ {
+		// Mostly the same millisecond, sometimes a clock step back.
+		at := now
+		if i%100 == 99 {
+			at = now.Add(-time.Second)
+		}
+
+		id := newULID(at)
+		if len(id) != 26 {
+			t.Fatalf("ULID %q has %d characters, want 26", id, len(id))
+		}
+		if id <= prev {
+			t.Fatalf("ULID %d: %s doesn't sort after %s", i, id, prev)
+		}
+		prev = id
+	}
+
+	if later := newULID(now.Add(time.Hour)); later[:10] == prev[:10] {
+		t.Fatalf("ULID an hour later %s kept the timestamp of %s", later, prev)
+	}
+}
+
+func TestInsertDoesNotOverwrite(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{IDGenerator: func() string { return "same" }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.Insert("users", map[string]string{"name": "Kamo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Insert("users", map[string]string{"name": "Ellen"}); !errors.Is(err, ErrRecordExists) {
+		t.Fatalf("Insert under a taken name = %v, want ErrRecordExists", err)
+	}
+
+	var user map[string]string
+	if err := db.Read("users", id, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user["name"] != "Kamo" {
+		t.Fatalf("first insert overwritten: %v", user)
+	}
+}
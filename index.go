@@ -0,0 +1,777 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An index maps the values a field takes in the records of a collection to
+// the records holding them, so FindBy reads only the matching records
+// instead of the whole collection. The indexed fields are listed in the
+// collection's config, and each index is kept in a hidden
+// ".<field>.index" file in the collection's directory, which is loaded the
+// first time the driver needs it. Records lacking the field aren't in it.
+//
+// The file is a journal: one JSON line per change, {"r":resource,"v":value}
+// when a record takes a value and {"r":resource,"d":true} when it drops
+// out, replayed in order on load. Every write and delete made through the
+// driver updates the indexes of its collection in memory and appends a
+// line to each whose entry changed, so it costs one small append however
+// large the collection is (BenchmarkWriteIndexed measures it). Once a file
+// holds more than twice as many lines as entries, plus 64, it is
+// compacted, rewritten with one line per entry, which costs a write of the
+// whole index but happens only every so many writes.
+//
+// Swap reindexes the two records it exchanges, RenameCollection and Rotate
+// move index files along with the records, and ReplaceCollection, Rotate,
+// Freeze and Thaw leave the collection they fill without any, so its
+// indexes are stale. An index is also stale after failing to save it, and
+// when its file is missing or doesn't replay, e.g. one a crash cut short.
+// A stale index is rebuilt from the records by the next FindBy; with
+// Options.RebuildIndexes every index is, the first time it is used after
+// New or Refresh. Changes made by other processes or by hand aren't seen
+// otherwise: CheckIndexes reports where indexes and records disagree, and
+// RebuildIndex and ReindexCollection bring indexes back in line.
+//
+// Values are compared as in Query, so numbers match by value whatever
+// their formatting. FindBy reads every record the index points to and
+// checks the field again, so an index that is out of date can miss
+// records, but never returns ones that don't match. Indexes need JSON
+// records.
+
+type index struct {
+	values map[string]string          // resource -> value key
+	byKey  map[string]map[string]bool // value key -> resources
+	lines  int                        // lines in the file
+	stale  bool
+}
+
+// indexEntry is a line of an index file.
+type indexEntry struct {
+	Resource string          `json:"r"`
+	Value    json.RawMessage `json:"v,omitempty"`
+	Deleted  bool            `json:"d,omitempty"`
+}
+
+// compactAt is the number of lines past which an index file holding
+// entries entries is rewritten.
+func compactAt(entries int) int {
+	return 2*entries + 64
+}
+
+type indexSet struct {
+	mu      sync.Mutex
+	indexes map[string]map[string]*index // collection -> field -> index
+}
+
+func newIndex() *index {
+	return &index{values: make(map[string]string), byKey: make(map[string]map[string]bool)}
+}
+
+// set records that resource holds the value with key in the field, or
+// lacks the field if !ok, and reports whether that changed anything.
+func (idx *index) set(resource, key string, ok bool) bool {
+	old, had := idx.values[resource]
+	if had == ok && old == key {
+		return false
+	}
+
+	if had {
+		delete(idx.byKey[old], resource)
+		if len(idx.byKey[old]) == 0 {
+			delete(idx.byKey, old)
+		}
+		delete(idx.values, resource)
+	}
+
+	if ok {
+		idx.values[resource] = key
+		if idx.byKey[key] == nil {
+			idx.byKey[key] = make(map[string]bool)
+		}
+		idx.byKey[key][resource] = true
+	}
+
+	return true
+}
+
+// indexKey identifies a decoded value in an index: its JSON with every
+// number in the same form.
+func indexKey(v interface{}) (string, error) {
+	b, err := json.Marshal(normalizeNumbers(v))
+	return string(b), err
+}
+
+func normalizeNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = normalizeNumbers(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, e := range t {
+			a[i] = normalizeNumbers(e)
+		}
+		return a
+	}
+
+	return v
+}
+
+func indexed(cfg CollectionConfig, field string) bool {
+	for _, f := range cfg.Indexes {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Driver) indexPath(collection, field string) string {
+	return filepath.Join(d.collectionDir(collection), "."+d.encodeKey(field)+".index")
+}
+
+func (d *Driver) checkIndex(collection, field string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - no index to use!")
+	}
+
+	if !dottedPath(field) || strings.ContainsAny(field, "/\\\x00") {
+		return fmt.Errorf("Invalid index %q of '%s' - indexes are on dotted field names!", field, collection)
+	}
+
+	return d.validateNames(collection)
+}
+
+// loadIndex returns the index of field in collection, reading its file if
+// the driver hasn't yet; an index without a usable file is stale. The
+// caller holds d.indexes.mu.
+func (d *Driver) loadIndex(collection, field string) *index {
+	if idx := d.indexes.indexes[collection][field]; idx != nil {
+		return idx
+	}
+
+	idx := newIndex()
+
+	var b []byte
+	err := d.io(func() (err error) {
+		b, err = ioutil.ReadFile(d.indexPath(collection, field))
+		return err
+	})
+
+	if err == nil && !d.opts.RebuildIndexes {
+		err = idx.replay(b)
+	}
+
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		d.logKV(LevelWarn, "unable to load index, rebuilding it", "op", "index", "collection", collection, "field", field, "error", err)
+		idx.stale = true
+	case err != nil, d.opts.RebuildIndexes:
+		idx.stale = true
+	}
+
+	d.setIndex(collection, field, idx)
+	return idx
+}
+
+// setIndex installs idx as the index of field in collection. The caller
+// holds d.indexes.mu.
+func (d *Driver) setIndex(collection, field string, idx *index) {
+	if d.indexes.indexes == nil {
+		d.indexes.indexes = make(map[string]map[string]*index)
+	}
+	if d.indexes.indexes[collection] == nil {
+		d.indexes.indexes[collection] = make(map[string]*index)
+	}
+	d.indexes.indexes[collection][field] = idx
+}
+
+// replay applies the lines of an index file to idx.
+func (idx *index) replay(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		var e indexEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if e.Resource == "" || e.Deleted == (len(e.Value) > 0) {
+			return fmt.Errorf("invalid index entry %d", idx.lines+1)
+		}
+
+		idx.set(e.Resource, string(e.Value), !e.Deleted)
+		idx.lines++
+	}
+}
+
+func (idx *index) entry(resource string) ([]byte, error) {
+	key, ok := idx.values[resource]
+	if !ok {
+		return json.Marshal(indexEntry{Resource: resource, Deleted: true})
+	}
+	return json.Marshal(indexEntry{Resource: resource, Value: json.RawMessage(key)})
+}
+
+// saveIndex rewrites the file of an index with a line per entry. The
+// caller holds d.indexes.mu.
+func (d *Driver) saveIndex(collection, field string, idx *index) error {
+	resources := make([]string, 0, len(idx.values))
+	for resource := range idx.values {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	var buf bytes.Buffer
+	for _, resource := range resources {
+		b, err := idx.entry(resource)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(b, byte('\n')))
+	}
+
+	err := d.io(func() error {
+		if err := d.mkdirAll(d.collectionDir(collection)); err != nil {
+			return err
+		}
+		return d.writeFileAtomic(d.indexPath(collection, field), buf.Bytes())
+	})
+	if err == nil {
+		idx.lines = len(resources)
+	}
+	return err
+}
+
+// appendIndex adds the line for resource's entry to the file of an index,
+// compacting the file instead once it has grown past compactAt. The caller
+// holds d.indexes.mu.
+func (d *Driver) appendIndex(collection, field, resource string, idx *index) error {
+	if idx.lines+1 > compactAt(len(idx.values)) {
+		return d.saveIndex(collection, field, idx)
+	}
+
+	b, err := idx.entry(resource)
+	if err != nil {
+		return err
+	}
+
+	err = d.io(func() error {
+		if err := d.mkdirAll(d.collectionDir(collection)); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(d.indexPath(collection, field), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write(append(b, byte('\n'))); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err == nil {
+		idx.lines++
+	}
+	return err
+}
+
+// staleIndex marks an index stale and removes its file, so another driver
+// doesn't trust it either. The caller holds d.indexes.mu.
+func (d *Driver) staleIndex(collection, field string) {
+	idx := newIndex()
+	idx.stale = true
+	d.setIndex(collection, field, idx)
+
+	path := d.indexPath(collection, field)
+	if err := d.io(func() error { return os.Remove(path) }); err != nil && !os.IsNotExist(err) {
+		d.logKV(LevelError, "unable to remove stale index", "op", "index", "collection", collection, "field", field, "path", path, "error", err)
+	}
+}
+
+// reindex brings the indexes of collection up to date with b, the new
+// contents of resource, or its deletion if b is nil. Indexes that can't be
+// saved are marked stale rather than failing a write already made.
+func (d *Driver) reindex(collection, resource string, b []byte) {
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil || len(cfg.Indexes) == 0 || !d.jsonRecords() {
+		return
+	}
+
+	var doc interface{}
+	if b != nil {
+		// A record that isn't valid JSON drops out of the indexes.
+		doc, _ = decodeDocument(b)
+	}
+
+	resource = d.foldKey(resource)
+
+	d.indexes.mu.Lock()
+	defer d.indexes.mu.Unlock()
+
+	for _, field := range cfg.Indexes {
+		idx := d.loadIndex(collection, field)
+		if idx.stale {
+			continue
+		}
+
+		value, ok := lookupField(doc, field)
+		key := ""
+		if ok {
+			key, err = indexKey(value)
+			ok = err == nil
+		}
+
+		if !idx.set(resource, key, ok) {
+			continue
+		}
+
+		if err := d.appendIndex(collection, field, resource, idx); err != nil {
+			d.logKV(LevelError, "unable to save index", "op", "index", "collection", collection, "field", field, "error", err)
+			d.staleIndex(collection, field)
+		}
+	}
+}
+
+// forgetIndexes drops what the driver holds of the indexes of collection,
+// or of every collection if it is "", so they are read from disk again.
+func (d *Driver) forgetIndexes(collection string) {
+	d.indexes.mu.Lock()
+	defer d.indexes.mu.Unlock()
+
+	if collection == "" {
+		d.indexes.indexes = nil
+		return
+	}
+	delete(d.indexes.indexes, collection)
+}
+
+// buildIndex reads every record of collection into a new index of field.
+// The caller holds the collection lock.
+func (d *Driver) buildIndex(collection, field string) (*index, error) {
+	idx := newIndex()
+
+	names, err := d.resources(collection)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to index '%s' in '%s': %v", name, collection, err)
+		}
+
+		if value, ok := lookupField(doc, field); ok {
+			key, err := indexKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to index '%s' in '%s': %v", name, collection, err)
+			}
+			idx.set(d.foldKey(name), key, true)
+		}
+	}
+
+	return idx, nil
+}
+
+// rebuildIndexes replaces the indexes of fields in collection with ones
+// built from the records, under the collection lock.
+func (d *Driver) rebuildIndexes(collection string, fields []string) error {
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	for _, field := range fields {
+		idx, err := d.buildIndex(collection, field)
+		if err != nil {
+			return fmt.Errorf("Unable to rebuild index '%s' of '%s' - %w", field, collection, err)
+		}
+
+		d.indexes.mu.Lock()
+		err = d.saveIndex(collection, field, idx)
+		if err != nil {
+			d.staleIndex(collection, field)
+		} else {
+			d.setIndex(collection, field, idx)
+		}
+		d.indexes.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateIndex adds field, a dotted path as in Project, to the indexes of
+// collection and builds its index from the records, as described at the
+// top of index.go. Creating an index that exists does nothing.
+func (d *Driver) CreateIndex(collection, field string) error {
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+
+	if !d.jsonRecords() {
+		return fmt.Errorf("Unable to index '%s' - indexes need JSON records!", collection)
+	}
+
+	if err := d.authorize(OperationWrite, collection, ""); err != nil {
+		return err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return err
+	}
+
+	if indexed(cfg, field) {
+		return nil
+	}
+
+	idx, err := d.buildIndex(collection, field)
+	if err != nil {
+		return err
+	}
+
+	d.indexes.mu.Lock()
+	err = d.saveIndex(collection, field, idx)
+	if err == nil {
+		d.setIndex(collection, field, idx)
+	}
+	d.indexes.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	cfg.Indexes = append(append([]string(nil), cfg.Indexes...), field)
+	return d.saveConfig(collection, cfg)
+}
+
+// DropIndex removes field from the indexes of collection, along with its
+// index file. Dropping an index that doesn't exist does nothing.
+func (d *Driver) DropIndex(collection, field string) error {
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationWrite, collection, ""); err != nil {
+		return err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return err
+	}
+
+	if !indexed(cfg, field) {
+		return nil
+	}
+
+	fields := []string{}
+	for _, f := range cfg.Indexes {
+		if f != field {
+			fields = append(fields, f)
+		}
+	}
+	cfg.Indexes = fields
+
+	if err := d.saveConfig(collection, cfg); err != nil {
+		return err
+	}
+
+	d.indexes.mu.Lock()
+	delete(d.indexes.indexes[collection], field)
+	d.indexes.mu.Unlock()
+
+	err = d.io(func() error { return os.Remove(d.indexPath(collection, field)) })
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// RebuildIndex rebuilds the index of field in collection from the
+// records, for when its file is out of sync with them, e.g. after another
+// process wrote to the collection.
+func (d *Driver) RebuildIndex(collection, field string) error {
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationWrite, collection, ""); err != nil {
+		return err
+	}
+
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return err
+	}
+
+	if !indexed(cfg, field) {
+		return fmt.Errorf("Unable to rebuild index '%s' of '%s' - the field isn't indexed!", field, collection)
+	}
+
+	return d.rebuildIndexes(collection, []string{field})
+}
+
+// ReindexCollection rebuilds every index of collection from its records,
+// under the collection lock, as RebuildIndex does for one.
+func (d *Driver) ReindexCollection(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - no indexes to rebuild!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationWrite, collection, ""); err != nil {
+		return err
+	}
+
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return err
+	}
+
+	return d.rebuildIndexes(collection, cfg.Indexes)
+}
+
+// Kinds of IndexProblem.
+const (
+	// IndexStale: the index has no usable file, or was marked stale, and
+	// will be rebuilt by the next FindBy.
+	IndexStale = "stale"
+
+	// IndexOrphaned: the index has an entry for a record that doesn't
+	// exist.
+	IndexOrphaned = "orphaned"
+
+	// IndexMissing: a record holds the field but isn't in the index.
+	IndexMissing = "missing"
+
+	// IndexMismatch: the index holds a value for a record other than the
+	// one the record has in the field, or one it doesn't have at all.
+	IndexMismatch = "mismatch"
+)
+
+// IndexProblem is a discrepancy CheckIndexes found between an index and
+// the records. Resource is empty for IndexStale.
+type IndexProblem struct {
+	Field    string
+	Resource string
+	Kind     string
+}
+
+// CheckIndexes compares every index of collection with the records and
+// reports where they disagree, sorted by field and resource, without
+// changing anything; ReindexCollection fixes what it finds. It reads the
+// whole collection once per index, under the collection's read lock.
+func (d *Driver) CheckIndexes(collection string) ([]IndexProblem, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - no indexes to check!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := d.rlockCollection(collection)
+	defer unlock()
+
+	names, err := d.resources(collection)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[d.foldKey(name)] = true
+	}
+
+	problems := []IndexProblem{}
+	for _, field := range cfg.Indexes {
+		want, err := d.buildIndex(collection, field)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to check index '%s' of '%s' - %w", field, collection, err)
+		}
+
+		d.indexes.mu.Lock()
+		idx := d.loadIndex(collection, field)
+		have := make(map[string]string, len(idx.values))
+		for resource, key := range idx.values {
+			have[resource] = key
+		}
+		stale := idx.stale
+		d.indexes.mu.Unlock()
+
+		if stale {
+			problems = append(problems, IndexProblem{Field: field, Kind: IndexStale})
+			continue
+		}
+
+		for resource, key := range have {
+			wantKey, ok := want.values[resource]
+			switch {
+			case !exists[resource]:
+				problems = append(problems, IndexProblem{field, resource, IndexOrphaned})
+			case !ok || wantKey != key:
+				problems = append(problems, IndexProblem{field, resource, IndexMismatch})
+			}
+		}
+
+		for resource := range want.values {
+			if _, ok := have[resource]; !ok {
+				problems = append(problems, IndexProblem{field, resource, IndexMissing})
+			}
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Field != problems[j].Field {
+			return problems[i].Field < problems[j].Field
+		}
+		return problems[i].Resource < problems[j].Resource
+	})
+
+	return problems, nil
+}
+
+// FindBy decodes the records of collection whose field equals value, in
+// name order, into the slice v points to, appending one element per record
+// as Read would decode each. The field must be indexed, see CreateIndex;
+// only the records the index points to are read.
+func (d *Driver) FindBy(collection, field string, value interface{}, v interface{}) error {
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+
+	if err := checkSlicePtr(v); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(value)
+	var want interface{}
+	if err == nil {
+		want, err = decodeDocument(b)
+	}
+	var key string
+	if err == nil {
+		key, err = indexKey(want)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid lookup - unable to compare %s with %T: %v", field, value, err)
+	}
+
+	names, err := d.lookupIndex(collection, field, key)
+	if err != nil {
+		return err
+	}
+
+	var records []KeyedRecord
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return fmt.Errorf("Unable to read '%s' in '%s': %v", name, collection, err)
+		}
+
+		if got, ok := lookupField(doc, field); ok && jsonEqual(got, want) {
+			records = append(records, KeyedRecord{name, b})
+		}
+	}
+
+	return d.decodeAll(collection, records, v)
+}
+
+// lookupIndex returns the resources the index of field in collection has
+// for the value with key, sorted, rebuilding the index first if it is
+// stale.
+func (d *Driver) lookupIndex(collection, field, key string) ([]string, error) {
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if !indexed(cfg, field) {
+		return nil, fmt.Errorf("Unable to find by '%s' in '%s' - the field isn't indexed!", field, collection)
+	}
+
+	d.indexes.mu.Lock()
+	stale := d.loadIndex(collection, field).stale
+	d.indexes.mu.Unlock()
+
+	if stale {
+		if err := d.rebuildIndexes(collection, []string{field}); err != nil {
+			return nil, err
+		}
+	}
+
+	d.indexes.mu.Lock()
+	names := []string{}
+	for name := range d.loadIndex(collection, field).byKey[key] {
+		names = append(names, name)
+	}
+	d.indexes.mu.Unlock()
+
+	sort.Strings(names)
+	return names, nil
+}
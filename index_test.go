@@ -0,0 +1,296 @@
+package godb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type indexedUser struct {
+	Name    string
+	Address struct{ City string }
+}
+
+func newIndexedUsers(t *testing.T, dir string) *Driver {
+	t.Helper()
+
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, city := range map[string]string{"el": "Pretoria", "kamo": "Joburg", "ellie": "Pretoria"} {
+		var u indexedUser
+		u.Name, u.Address.City = name, city
+		if err := db.Write("users", name, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.CreateIndex("users", "Address.City"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func findNames(t *testing.T, db *Driver, city string) []string {
+	t.Helper()
+
+	var found []indexedUser
+	if err := db.FindBy("users", "Address.City", city, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, u := range found {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+func TestFindByFollowsWritesAndDeletes(t *testing.T) {
+	db := newIndexedUsers(t, t.TempDir())
+
+	if got := findNames(t, db, "Pretoria"); !reflect.DeepEqual(got, []string{"el", "ellie"}) {
+		t.Fatalf("FindBy Pretoria = %v", got)
+	}
+
+	var u indexedUser
+	u.Name, u.Address.City = "kamo", "Pretoria"
+	if err := db.Write("users", "kamo", u); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("users", "el"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findNames(t, db, "Pretoria"); !reflect.DeepEqual(got, []string{"ellie", "kamo"}) {
+		t.Fatalf("FindBy Pretoria after changes = %v", got)
+	}
+	if got := findNames(t, db, "Joburg"); len(got) != 0 {
+		t.Fatalf("FindBy Joburg after changes = %v", got)
+	}
+}
+
+func TestCheckIndexesAndReindexCollection(t *testing.T) {
+	dir := t.TempDir()
+	newIndexedUsers(t, dir)
+
+	// Changes behind the driver's back.
+	if err := os.WriteFile(filepath.Join(dir, "users", "kamzo.json"), []byte(`{"Name":"kamzo","Address":{"City":"Pretoria"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "users", "el.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users", "kamo.json"), []byte(`{"Name":"kamo","Address":{"City":"Durban"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := db.CheckIndexes("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexProblem{
+		{"Address.City", "el", IndexOrphaned},
+		{"Address.City", "kamo", IndexMismatch},
+		{"Address.City", "kamzo", IndexMissing},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Fatalf("CheckIndexes = %v, want %v", problems, want)
+	}
+
+	if err := db.ReindexCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err = db.CheckIndexes("users"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after reindex = %v, %v", problems, err)
+	}
+	if got := findNames(t, db, "Pretoria"); !reflect.DeepEqual(got, []string{"ellie", "kamzo"}) {
+		t.Fatalf("FindBy Pretoria after reindex = %v", got)
+	}
+}
+
+func TestIndexJournalReplaysAndCompacts(t *testing.T) {
+	dir := t.TempDir()
+	db := newIndexedUsers(t, dir)
+	path := filepath.Join(dir, "users", ".Address.City.index")
+
+	lines := func() int {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Count(b, []byte("\n"))
+	}
+
+	if n := lines(); n != 3 {
+		t.Fatalf("index has %d lines after CreateIndex, want 3", n)
+	}
+
+	var u indexedUser
+	u.Name = "kamo"
+	for i := 0; i < 10; i++ {
+		u.Address.City = fmt.Sprintf("City %d", i)
+		if err := db.Write("users", "kamo", u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("users", "el"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := lines(); n != 14 {
+		t.Fatalf("index has %d lines after 11 changes, want 14", n)
+	}
+
+	// A new driver replays the journal rather than rebuilding.
+	reopened, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := reopened.CheckIndexes("users"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after reopening = %v, %v", problems, err)
+	}
+	if got := findNames(t, reopened, "City 9"); !reflect.DeepEqual(got, []string{"kamo"}) {
+		t.Fatalf("FindBy City 9 = %v", got)
+	}
+
+	for i := 0; i < compactAt(2); i++ {
+		u.Address.City = fmt.Sprintf("Town %d", i)
+		if err := reopened.Write("users", "kamo", u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := lines(); n > compactAt(2) {
+		t.Fatalf("index has %d lines, want it compacted to at most %d", n, compactAt(2))
+	}
+	if problems, err := reopened.CheckIndexes("users"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after compacting = %v, %v", problems, err)
+	}
+}
+
+func TestTornIndexJournalIsRebuilt(t *testing.T) {
+	dir := t.TempDir()
+	newIndexedUsers(t, dir)
+
+	f, err := os.OpenFile(filepath.Join(dir, "users", ".Address.City.index"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"r":"kamo","v":"Dur`)
+	f.Close()
+
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := findNames(t, db, "Joburg"); !reflect.DeepEqual(got, []string{"kamo"}) {
+		t.Fatalf("FindBy Joburg after a torn journal = %v", got)
+	}
+}
+
+func TestBulkOperationsKeepIndexesInLine(t *testing.T) {
+	db := newIndexedUsers(t, t.TempDir())
+
+	if err := db.Append("users", "kamo", map[string]string{"event": "login"}); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := db.CheckIndexes("users"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after Append = %v, %v", problems, err)
+	}
+
+	if err := db.Swap("users", "el", "kamo"); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := db.CheckIndexes("users"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after Swap = %v, %v", problems, err)
+	}
+
+	if err := db.RenameCollection("users", "people"); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := db.CheckIndexes("people"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after RenameCollection = %v, %v", problems, err)
+	}
+	// el now holds what kamo did.
+	var found []indexedUser
+	if err := db.FindBy("people", "Address.City", "Joburg", &found); err != nil || len(found) != 1 || found[0].Name != "kamo" {
+		t.Fatalf("FindBy Joburg after Swap and RenameCollection = %v, %v", found, err)
+	}
+}
+
+func BenchmarkWriteIndexed(b *testing.B) {
+	for _, bc := range []struct {
+		name    string
+		indexed bool
+	}{{"unindexed", false}, {"indexed", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			db, err := New(b.TempDir(), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var u indexedUser
+			for i := 0; i < 1000; i++ {
+				u.Name, u.Address.City = fmt.Sprintf("user%d", i), fmt.Sprintf("City %d", i%50)
+				if err := db.Write("users", u.Name, u); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if bc.indexed {
+				if err := db.CreateIndex("users", "Address.City"); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				u.Name, u.Address.City = fmt.Sprintf("user%d", i%1000), fmt.Sprintf("City %d", i%50)
+				if err := db.Write("users", u.Name, u); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFreezeAndThawKeepIndexes(t *testing.T) {
+	dir := t.TempDir()
+	db := newIndexedUsers(t, dir)
+
+	if err := db.Freeze("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Thaw("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	var u indexedUser
+	u.Name, u.Address.City = "kamzo", "Pretoria"
+	if err := db.Write("users", "kamzo", u); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := findNames(t, reopened, "Pretoria"); !reflect.DeepEqual(got, []string{"el", "ellie", "kamzo"}) {
+		t.Fatalf("FindBy Pretoria after Freeze and Thaw = %v", got)
+	}
+	if problems, err := reopened.CheckIndexes("users"); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckIndexes after Freeze and Thaw = %v, %v", problems, err)
+	}
+}
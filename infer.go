@@ -0,0 +1,127 @@
+package godb
+
+import (
+	"sort"
+)
+
+// SchemaInfo is the shape of a collection's records as InferSchema found
+// it.
+type SchemaInfo struct {
+	// Records is how many records were scanned, Invalid the ones among
+	// them that aren't valid JSON, in ReadOrder.
+	Records int
+	Invalid []string
+
+	// Fields lists every field path seen, sorted by path.
+	Fields []FieldInfo
+}
+
+// FieldInfo describes one field path in a SchemaInfo. Paths are dotted as
+// in Schema's ValidationError, with "[]" standing for the elements of an
+// array: "address.city", "tags[]", "orders[].total". The record itself
+// has the empty path.
+type FieldInfo struct {
+	Path string
+
+	// Records is how many records have the field, and Types how many of
+	// them hold each type there, named as in Schema ("string", "number",
+	// "object" and so on; "integer" never shows up). A record whose
+	// array elements differ in type counts once for each.
+	Records int
+	Types   map[string]int
+
+	// Dominant is the type most records hold, ties going to the first by
+	// name, and Deviants the records, in ReadOrder, holding any other
+	// type there.
+	Dominant string
+	Deviants []string
+}
+
+// InferSchema scans every record of collection, streaming as ForEach does,
+// and reports each field path it finds with the types seen there and the
+// records that stray from the most common one, to spot drift such as an
+// age stored as a string in some records and a number in others. A field
+// some records lack isn't drift; compare FieldInfo.Records with
+// SchemaInfo.Records to find optional fields.
+func (d *Driver) InferSchema(collection string) (SchemaInfo, error) {
+	var info SchemaInfo
+
+	fields := make(map[string]*FieldInfo)
+	seen := make(map[string]map[string]map[string]bool)
+	var order []string
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		info.Records++
+		order = append(order, resource)
+
+		doc, err := decodeDocument(data)
+		if err != nil {
+			info.Invalid = append(info.Invalid, resource)
+			return nil
+		}
+
+		types := make(map[string]map[string]bool)
+		inferTypes("", doc, types)
+
+		for path, set := range types {
+			field, ok := fields[path]
+			if !ok {
+				field = &FieldInfo{Path: path, Types: make(map[string]int)}
+				fields[path] = field
+				seen[path] = make(map[string]map[string]bool)
+			}
+
+			field.Records++
+			for t := range set {
+				field.Types[t]++
+			}
+			seen[path][resource] = set
+		}
+
+		return nil
+	})
+	if err != nil {
+		return SchemaInfo{}, err
+	}
+
+	info.Fields = make([]FieldInfo, 0, len(fields))
+	for path, field := range fields {
+		for t, n := range field.Types {
+			if n > field.Types[field.Dominant] || n == field.Types[field.Dominant] && t < field.Dominant {
+				field.Dominant = t
+			}
+		}
+
+		for _, name := range order {
+			set, ok := seen[path][name]
+			if ok && (len(set) > 1 || !set[field.Dominant]) {
+				field.Deviants = append(field.Deviants, name)
+			}
+		}
+
+		info.Fields = append(info.Fields, *field)
+	}
+
+	sort.Slice(info.Fields, func(i, j int) bool { return info.Fields[i].Path < info.Fields[j].Path })
+
+	return info, nil
+}
+
+// inferTypes records the type of v at path, and of everything nested in it.
+func inferTypes(path string, v interface{}, types map[string]map[string]bool) {
+	if types[path] == nil {
+		types[path] = make(map[string]bool)
+	}
+	types[path][typeName(v)] = true
+
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for field, fv := range c {
+			inferTypes(joinPath(path, field), fv, types)
+		}
+	case []interface{}:
+		for _, e := range c {
+			inferTypes(path+"[]", e, types)
+		}
+	}
+}
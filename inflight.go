@@ -0,0 +1,129 @@
+package godb
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpInfo is an operation holding, or waiting for, a collection or record
+// lock, as listed by InFlight.
+type OpInfo struct {
+	// Op is the Driver method that took the lock, such as "Write" or
+	// "ReplaceCollection", or empty if it can't be told.
+	Op         string
+	Collection string
+
+	// Resource is the record locked, or empty for the whole collection.
+	Resource string
+
+	// Exclusive is false for shared holds, as taken by ReadAll.
+	Exclusive bool
+
+	Started time.Time
+
+	// Waiting is true until the lock is acquired.
+	Waiting bool
+}
+
+// inflightOps is the registry behind InFlight; a nil one tracks nothing.
+type inflightOps struct {
+	mu   sync.Mutex
+	next uint64
+	ops  map[uint64]*OpInfo
+}
+
+func newInflightOps(opts Options) *inflightOps {
+	if !opts.TrackInFlight {
+		return nil
+	}
+	return &inflightOps{ops: make(map[uint64]*OpInfo)}
+}
+
+// begin registers an operation about to wait for a lock.
+func (r *inflightOps) begin(collection, resource string, exclusive bool) uint64 {
+	if r == nil {
+		return 0
+	}
+
+	info := &OpInfo{calledOp(), collection, resource, exclusive, time.Now(), true}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next++
+	r.ops[r.next] = info
+	return r.next
+}
+
+func (r *inflightOps) locked(id uint64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info, ok := r.ops[id]; ok {
+		info.Waiting = false
+	}
+}
+
+func (r *inflightOps) end(id uint64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.ops, id)
+}
+
+// calledOp finds the exported Driver method on the caller's stack.
+func calledOp() string {
+	var pcs [24]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+
+	prefix := modulePath + ".(*Driver)."
+	for {
+		frame, more := frames.Next()
+
+		if name := strings.TrimPrefix(frame.Function, prefix); name != frame.Function {
+			if i := strings.IndexByte(name, '.'); i >= 0 {
+				name = name[:i]
+			}
+			if name != "" && name[0] >= 'A' && name[0] <= 'Z' {
+				return name
+			}
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+// InFlight lists the operations holding or waiting for a collection or
+// record lock, longest running first, to find what a stuck or slow request
+// is waiting on. Reads that take no lock, like Read, aren't listed. It is
+// empty unless Options.TrackInFlight is set, which costs a stack walk and a
+// mutex round trip per lock.
+func (d *Driver) InFlight() []OpInfo {
+	r := d.inflight
+	if r == nil {
+		return []OpInfo{}
+	}
+
+	r.mu.Lock()
+	ops := make([]OpInfo, 0, len(r.ops))
+	for _, info := range r.ops {
+		ops = append(ops, *info)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Started.Before(ops[j].Started) })
+	return ops
+}
@@ -0,0 +1,72 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// ioError marks a storage-level failure, such as a full disk, while keeping
+// the original error reachable through errors.Unwrap.
+type ioError struct {
+	kind error
+	err  error
+}
+
+func (e *ioError) Error() string { return e.kind.Error() + ": " + e.err.Error() }
+
+func (e *ioError) Unwrap() error { return e.err }
+
+func (e *ioError) Is(target error) bool { return target == e.kind }
+
+// classifyIOError wraps err in ErrNoSpace or ErrReadOnlyFS when it stems
+// from a full disk, an exceeded quota or a read-only file system, so
+// errors.Is can single those conditions out.
+func classifyIOError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if kind := fatalIOKind(err); kind != nil {
+		return &ioError{kind, err}
+	}
+
+	return err
+}
+
+// probeWritable checks that dir exists and that a file can be created,
+// written and removed in it. A missing directory is reported as
+// os.ErrNotExist, anything else as ErrNotWritable wrapping the cause, which
+// classifyIOError may have marked ErrNoSpace or ErrReadOnlyFS.
+func probeWritable(dir string) error {
+	fi, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Database directory '%s' does not exist: %w", dir, os.ErrNotExist)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("Database directory '%s' is not a directory!", dir)
+	}
+
+	f, err := ioutil.TempFile(dir, ".probe-*")
+	if err != nil {
+		return &ioError{ErrNotWritable, fmt.Errorf("%s: %w", dir, classifyIOError(err))}
+	}
+
+	_, err = f.Write([]byte{'\n'})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+
+	if err != nil {
+		return &ioError{ErrNotWritable, fmt.Errorf("%s: %w", dir, classifyIOError(err))}
+	}
+
+	return nil
+}
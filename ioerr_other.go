@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package godb
+
+func fatalIOKind(err error) error {
+	return nil
+}
+
+func isCrossDevice(err error) bool {
+	return false
+}
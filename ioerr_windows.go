@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package godb
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	errorHandleDiskFull syscall.Errno = 39
+	errorDiskFull       syscall.Errno = 112
+	errorWriteProtect   syscall.Errno = 19
+	errorNotSameDevice  syscall.Errno = 17
+)
+
+func fatalIOKind(err error) error {
+	switch {
+	case errors.Is(err, errorDiskFull), errors.Is(err, errorHandleDiskFull):
+		return ErrNoSpace
+	case errors.Is(err, errorWriteProtect):
+		return ErrReadOnlyFS
+	}
+
+	return nil
+}
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
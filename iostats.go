@@ -0,0 +1,70 @@
+package godb
+
+import "sync/atomic"
+
+// IOStat holds cumulative counts of the disk work done for records since
+// the driver was opened.
+type IOStat struct {
+	BytesRead    int64
+	BytesWritten int64
+	TempFiles    int64
+	Renames      int64
+	Syncs        int64
+}
+
+// ioCounters is updated with atomic adds. It is allocated on its own so
+// its 64-bit fields stay aligned on 32-bit platforms.
+type ioCounters struct {
+	read, written, temps, renames, syncs int64
+}
+
+func (d *Driver) countRead(n int) {
+	if d.iostats != nil {
+		atomic.AddInt64(&d.iostats.read, int64(n))
+	}
+}
+
+func (d *Driver) countWrite(n int) {
+	if d.iostats != nil {
+		atomic.AddInt64(&d.iostats.written, int64(n))
+	}
+}
+
+// countTemp counts a temp file, or temp directory, created for a write.
+func (d *Driver) countTemp() {
+	if d.iostats != nil {
+		atomic.AddInt64(&d.iostats.temps, 1)
+	}
+}
+
+func (d *Driver) countRename() {
+	if d.iostats != nil {
+		atomic.AddInt64(&d.iostats.renames, 1)
+	}
+}
+
+func (d *Driver) countSync() {
+	if d.iostats != nil {
+		atomic.AddInt64(&d.iostats.syncs, 1)
+	}
+}
+
+// IOStats reports the bytes read from and written to record files, the
+// temp files created and renamed into place for atomic writes, and the
+// fsyncs issued, which shows how much each logical write costs on disk
+// under the chosen options. Files written outside the record paths -
+// exports, archives, maintenance rewrites - aren't counted. It is all zeros
+// under Options.DisableIOStats.
+func (d *Driver) IOStats() IOStat {
+	if d.iostats == nil {
+		return IOStat{}
+	}
+
+	return IOStat{
+		BytesRead:    atomic.LoadInt64(&d.iostats.read),
+		BytesWritten: atomic.LoadInt64(&d.iostats.written),
+		TempFiles:    atomic.LoadInt64(&d.iostats.temps),
+		Renames:      atomic.LoadInt64(&d.iostats.renames),
+		Syncs:        atomic.LoadInt64(&d.iostats.syncs),
+	}
+}
@@ -0,0 +1,213 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Select supports this subset of JSONPath:
+//
+//	$             the record itself; every path starts with it
+//	.name         the member name of an object
+//	['name']      the same, for names with dots, brackets or spaces
+//	.* or [*]     every member of an object, in name order, or every
+//	              element of an array
+//	[n]           element n of an array, counting from 0; negative n
+//	              counts from the end
+//	..name, ..*   the same as .name or .*, applied to the current node and
+//	              everything nested in it
+//
+// Filters, slices, unions and script expressions aren't supported, and
+// fail to parse. A step that doesn't match, like a name on an array or an
+// index out of range, just selects nothing.
+
+type pathStep struct {
+	// kind is one of '.' (member name), '*' (wildcard) or '[' (index).
+	kind    byte
+	name    string
+	index   int
+	descend bool
+}
+
+func parseJSONPath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("Invalid JSONPath '%s' - it must start with '$'!", path)
+	}
+
+	var steps []pathStep
+
+	for rest := path[1:]; rest != ""; {
+		var step pathStep
+
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.descend = true
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] == '[':
+		default:
+			return nil, fmt.Errorf("Invalid JSONPath '%s' - unexpected '%c'!", path, rest[0])
+		}
+
+		if rest == "" {
+			return nil, fmt.Errorf("Invalid JSONPath '%s' - missing name at the end!", path)
+		}
+
+		switch {
+		case rest[0] == '[' && !step.descend:
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid JSONPath '%s' - unclosed '['!", path)
+			}
+
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				step.kind = '*'
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				step.kind, step.name = '.', inner[1:len(inner)-1]
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid JSONPath '%s' - unsupported selector '[%s]'!", path, inner)
+				}
+				step.kind, step.index = '[', n
+			}
+		case rest[0] == '*':
+			step.kind = '*'
+			rest = rest[1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("Invalid JSONPath '%s' - missing name!", path)
+			}
+
+			step.kind, step.name = '.', rest[:end]
+			rest = rest[end:]
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// evalJSONPath returns what steps select in doc, in document order.
+func evalJSONPath(doc interface{}, steps []pathStep) []interface{} {
+	nodes := []interface{}{doc}
+
+	for _, step := range steps {
+		if step.descend {
+			var all []interface{}
+			for _, node := range nodes {
+				all = appendDescendants(all, node)
+			}
+			nodes = all
+		}
+
+		var next []interface{}
+		for _, node := range nodes {
+			next = step.apply(next, node)
+		}
+		nodes = next
+	}
+
+	return nodes
+}
+
+func (s pathStep) apply(out []interface{}, node interface{}) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		switch s.kind {
+		case '.':
+			if child, ok := v[s.name]; ok {
+				out = append(out, child)
+			}
+		case '*':
+			for _, key := range sortedKeys(v) {
+				out = append(out, v[key])
+			}
+		}
+	case []interface{}:
+		switch s.kind {
+		case '*':
+			out = append(out, v...)
+		case '[':
+			i := s.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				out = append(out, v[i])
+			}
+		}
+	}
+
+	return out
+}
+
+// appendDescendants appends node and everything nested in it, parents
+// before children.
+func appendDescendants(out []interface{}, node interface{}) []interface{} {
+	out = append(out, node)
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			out = appendDescendants(out, v[key])
+		}
+	case []interface{}:
+		for _, child := range v {
+			out = appendDescendants(out, child)
+		}
+	}
+
+	return out
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Select evaluates the JSONPath expression jsonPath, such as
+// "$.Address.City" or "$.orders[*].total", against every record of
+// collection in ReadOrder and returns everything it selects, record after
+// record. See the top of jsonpath.go for the supported syntax. Records are
+// streamed as in ForEach, so only the results are held in memory. Numbers
+// come back as json.Number.
+func (d *Driver) Select(collection, jsonPath string) ([]interface{}, error) {
+	steps, err := parseJSONPath(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []interface{}{}
+
+	err = d.ForEach(collection, func(resource string, data []byte) error {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			return fmt.Errorf("Unable to select from '%s': %v", resource, err)
+		}
+
+		results = append(results, evalJSONPath(doc, steps)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
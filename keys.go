@@ -0,0 +1,293 @@
+package godb
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// DefaultKeyValidator rejects empty names, names containing a path
+// separator or "..", and "." or any other name filepath.Clean would
+// change, so a key always names an entry of its own inside the database
+// or collection directory and can never resolve to that directory itself
+// or escape it. It also rejects names starting with a dot, which are the
+// driver's own files - the collection config, sequences, indexes, leases.
+func DefaultKeyValidator(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w - name must not be empty", ErrInvalidName)
+	}
+
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w %q - name must not contain a path separator", ErrInvalidName, name)
+	}
+
+	if strings.Contains(name, "..") {
+		return fmt.Errorf("%w %q - name must not contain '..'", ErrInvalidName, name)
+	}
+
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%w %q - name must not start with '.'", ErrInvalidName, name)
+	}
+
+	if filepath.Clean(name) != name {
+		return fmt.Errorf("%w %q - name must be a plain file name", ErrInvalidName, name)
+	}
+
+	return nil
+}
+
+// validateNames checks names as they will appear on disk, that is after
+// Options.KeyEncoder.
+func (d *Driver) validateNames(names ...string) error {
+	for _, name := range names {
+		if err := d.opts.KeyValidator(d.encodeKey(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteAuto writes v under the resource name held by its key field - the
+// struct field tagged `godb:"key"` (the tag name is configurable through
+// Options.KeyTag) - and returns the name used. The field must be a string
+// or an integer, and must not be empty.
+func (d *Driver) WriteAuto(collection string, v interface{}) (string, error) {
+	resource, err := d.extractKey(v)
+	if err != nil {
+		return "", err
+	}
+
+	if err := d.Write(collection, resource, v); err != nil {
+		return "", err
+	}
+
+	return resource, nil
+}
+
+func (d *Driver) extractKey(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", fmt.Errorf("Missing value - unable to extract key from nil!")
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return "", fmt.Errorf("Unable to extract key - %T is not a struct!", v)
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).Tag.Get(d.opts.KeyTag) != "key" {
+			continue
+		}
+
+		var key string
+		switch f := rv.Field(i); f.Kind() {
+		case reflect.String:
+			key = f.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			key = fmt.Sprint(f.Interface())
+		default:
+			return "", fmt.Errorf("Unable to extract key - field %s of %T must be a string or integer!", rt.Field(i).Name, v)
+		}
+
+		if key == "" {
+			return "", fmt.Errorf("Missing resource - key field %s of %T is empty!", rt.Field(i).Name, v)
+		}
+
+		return key, nil
+	}
+
+	return "", fmt.Errorf("Missing resource - %T has no field tagged `%s:\"key\"`!", v, d.opts.KeyTag)
+}
+
+// DefaultKeySeparator is the default Options.KeySeparator. It is safe in
+// file names on every supported platform.
+const DefaultKeySeparator = "~"
+
+// keyEscapes are the bytes CompoundKey percent-escapes in key parts besides
+// those of the separator: the escape character itself, path separators and
+// dots, so no part can split differently, leave the collection directory
+// or turn the record into a hidden file.
+const keyEscapes = "%/\\."
+
+// checkKeySeparator rejects separators that could let a compound key
+// escape its collection directory or be mistaken for an escape.
+func checkKeySeparator(opts Options) error {
+	if strings.ContainsAny(opts.KeySeparator, keyEscapes+"\x00") {
+		return fmt.Errorf("Invalid key separator %q - must not contain '%%', '.', NUL or a path separator!", opts.KeySeparator)
+	}
+
+	return nil
+}
+
+// CompoundKey builds a resource name from parts, e.g. a tenant and a user
+// ID, that SplitKey turns back into the same parts whatever they contain,
+// joined by DefaultKeySeparator. The result passes DefaultKeyValidator, so
+// it can be used with Write, Read and every other method taking a resource
+// name. Driver.CompoundKey joins them by Options.KeySeparator instead.
+func CompoundKey(parts ...string) string {
+	return compoundKey(DefaultKeySeparator, parts)
+}
+
+// KeyPrefix returns the prefix shared by every compound key starting with
+// parts, for use with ReadPrefix: ReadPrefix("users", KeyPrefix(tenant))
+// reads all of a tenant's users.
+func KeyPrefix(parts ...string) string {
+	return CompoundKey(parts...) + DefaultKeySeparator
+}
+
+// SplitKey returns the parts of a key built by CompoundKey. Malformed escapes
+// are kept as is.
+func SplitKey(key string) []string {
+	parts, _ := splitKey(DefaultKeySeparator, key)
+	return parts
+}
+
+// CompoundKey is the package's CompoundKey joining parts by
+// Options.KeySeparator. Every byte of the separator is escaped in the
+// parts, and the separator can't hold a path separator or a dot, so the
+// key can't reach outside its collection whatever the parts hold.
+func (d *Driver) CompoundKey(parts ...string) string {
+	return compoundKey(d.opts.KeySeparator, parts)
+}
+
+// KeyPrefix is the package's KeyPrefix for Driver.CompoundKey keys.
+func (d *Driver) KeyPrefix(parts ...string) string {
+	return d.CompoundKey(parts...) + d.opts.KeySeparator
+}
+
+// SplitKey returns the parts of a key built by Driver.CompoundKey. Unlike
+// the package's SplitKey it checks the key, failing with ErrInvalidName if
+// a part holds a malformed escape or a byte CompoundKey escapes - such as
+// part of the separator - unescaped.
+func (d *Driver) SplitKey(key string) ([]string, error) {
+	parts, err := splitKey(d.opts.KeySeparator, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+func compoundKey(sep string, parts []string) string {
+	escaped := make([]string, len(parts))
+
+	for i, part := range parts {
+		var b strings.Builder
+		for j := 0; j < len(part); j++ {
+			if strings.IndexByte(keyEscapes, part[j]) >= 0 || strings.IndexByte(sep, part[j]) >= 0 {
+				fmt.Fprintf(&b, "%%%02X", part[j])
+				continue
+			}
+			b.WriteByte(part[j])
+		}
+		escaped[i] = b.String()
+	}
+
+	return strings.Join(escaped, sep)
+}
+
+func splitKey(sep, key string) ([]string, error) {
+	parts := strings.Split(key, sep)
+
+	var err error
+	for i, part := range parts {
+		if strings.ContainsAny(part, sep+"/\\.") && err == nil {
+			err = fmt.Errorf("%w %q - part %q holds bytes CompoundKey escapes", ErrInvalidName, key, part)
+		}
+
+		s, uerr := url.PathUnescape(part)
+		if uerr != nil {
+			if err == nil {
+				err = fmt.Errorf("%w %q - %v", ErrInvalidName, key, uerr)
+			}
+			continue
+		}
+		parts[i] = s
+	}
+
+	return parts, err
+}
+
+// foldKey returns the canonical form of a resource name: lower-cased under
+// Options.CaseInsensitiveKeys, otherwise name itself.
+func (d *Driver) foldKey(name string) string {
+	if d.opts.CaseInsensitiveKeys {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// encodeResource maps a resource name to its on-disk form.
+func (d *Driver) encodeResource(name string) string {
+	return d.encodeKey(d.foldKey(name))
+}
+
+// recordKey identifies a record in the driver's in-memory maps.
+func (d *Driver) recordKey(collection, resource string) string {
+	return cacheKey(collection, d.foldKey(resource))
+}
+
+// encodeKey maps a collection or resource name to its on-disk form.
+func (d *Driver) encodeKey(name string) string {
+	if d.opts.KeyEncoder == nil {
+		return name
+	}
+	return d.opts.KeyEncoder(name)
+}
+
+// decodeKey maps an on-disk name back to the name callers used.
+func (d *Driver) decodeKey(name string) string {
+	if d.opts.KeyDecoder == nil {
+		return name
+	}
+	return d.opts.KeyDecoder(name)
+}
+
+// resourceName returns the resource name of a record file or directory.
+func (d *Driver) resourceName(file string) string {
+	return d.decodeKey(strings.TrimSuffix(file, d.ext()))
+}
+
+// EscapeKey is a KeyEncoder that percent-encodes every byte of name except
+// ASCII letters, digits and "-_.~@+=,", plus any dot that starts the name
+// or follows another dot, so that e-mail addresses, URLs and the like become
+// file names that are valid on every supported platform, can't be hidden
+// and never contain "..". UnescapeKey reverses it exactly. Names that differ
+// only in case still collide on case-insensitive file systems.
+func EscapeKey(name string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+
+		safe := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~@+=,", c) >= 0
+		if c == '.' && (i == 0 || name[i-1] == '.') {
+			safe = false
+		}
+
+		if safe {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// UnescapeKey is the KeyDecoder matching EscapeKey. Malformed escapes are
+// kept as is.
+func UnescapeKey(name string) string {
+	if s, err := url.PathUnescape(name); err == nil {
+		return s
+	}
+	return name
+}
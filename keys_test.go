@@ -0,0 +1,70 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultKeyValidator(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "a..b", "../x", ".hidden", ".config"} {
+		if err := DefaultKeyValidator(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("DefaultKeyValidator(%q) = %v, want ErrInvalidName", name, err)
+		}
+	}
+
+	for _, name := range []string{"users", "a.b", "Kamo"} {
+		if err := DefaultKeyValidator(name); err != nil {
+			t.Errorf("DefaultKeyValidator(%q) = %v, want nil", name, err)
+		}
+	}
+}
+
+func TestDeleteDotKeepsDatabase(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete(".", ""); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf(`Delete(".", "") = %v, want ErrInvalidName`, err)
+	}
+
+	if err := db.Delete("users", "."); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf(`Delete("users", ".") = %v, want ErrInvalidName`, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users", "kamo.json")); err != nil {
+		t.Fatalf("record gone after rejected deletes: %v", err)
+	}
+}
+
+func TestWriteRefusesConfigName(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ConfigureCollection("users", CollectionConfig{Timestamps: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", ".config", map[string]string{"name": "Kamo"}); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf(`Write("users", ".config") = %v, want ErrInvalidName`, err)
+	}
+
+	reopened, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := reopened.CollectionConfig("users"); err != nil || !cfg.Timestamps {
+		t.Fatalf("CollectionConfig after a refused write = %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,184 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Leases let worker processes sharing a database directory split up the
+// records of a collection, e.g. a queue of tasks: a worker Claims a record,
+// Renews the lease while it works and Releases it, or Deletes the record,
+// when done. A lease is a hidden ".<resource>.lease" file next to the
+// record holding its owner and expiry; a lease past its expiry can be
+// claimed by anyone, so the work of a crashed worker is picked up again.
+//
+// Within a process the lease checks run under the record's lock and are
+// atomic. Across processes they are not: claiming a free record creates the
+// lease file exclusively, so only one process wins it, but taking over an
+// expired lease replaces the file, and two processes doing so at the same
+// moment can both succeed. Leases also rely on every process's clock
+// agreeing. Size leases generously and keep the work idempotent.
+
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+func (d *Driver) leasePath(collection, resource string) string {
+	return filepath.Join(d.collectionDir(collection), "."+d.encodeResource(resource)+".lease")
+}
+
+func (d *Driver) readLease(collection, resource string) (lease, bool, error) {
+	var l lease
+
+	b, err := ioutil.ReadFile(d.leasePath(collection, resource))
+	if os.IsNotExist(err) {
+		return l, false, nil
+	}
+	if err != nil {
+		return l, false, err
+	}
+
+	if err := json.Unmarshal(b, &l); err != nil {
+		return l, false, fmt.Errorf("Invalid lease on '%s' in '%s': %v", resource, collection, err)
+	}
+
+	return l, true, nil
+}
+
+func (d *Driver) checkLease(collection, resource, workerID string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to lease!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to lease record (no name)!")
+	}
+
+	if workerID == "" {
+		return fmt.Errorf("Missing worker - unable to lease record (no owner)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	return d.authorize(OperationWrite, collection, resource)
+}
+
+// Claim leases a record to workerID for leaseDuration. It returns false if
+// another worker holds an unexpired lease on it, and ErrNotFound if the
+// record doesn't exist. Claiming a record the worker already holds extends
+// the lease.
+func (d *Driver) Claim(collection, resource string, leaseDuration time.Duration, workerID string) (bool, error) {
+	if err := d.checkLease(collection, resource, workerID); err != nil {
+		return false, err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	if _, err := d.statRecord(collection, resource); err != nil {
+		if os.IsNotExist(err) {
+			return false, ErrNotFound
+		}
+		return false, err
+	}
+
+	now := d.opts.Clock()
+
+	l, ok, err := d.readLease(collection, resource)
+	if err != nil {
+		return false, err
+	}
+
+	if ok && l.Owner != workerID && now.Before(l.Expires) {
+		return false, nil
+	}
+
+	b, err := json.Marshal(lease{workerID, now.Add(leaseDuration)})
+	if err != nil {
+		return false, err
+	}
+
+	path := d.leasePath(collection, resource)
+
+	if !ok {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			os.Remove(path)
+			return false, err
+		}
+
+		return true, f.Close()
+	}
+
+	if err := d.writeFileAtomic(path, b); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Renew extends workerID's lease on a record to leaseDuration from now. It
+// fails with ErrNotLeased unless the worker holds an unexpired lease.
+func (d *Driver) Renew(collection, resource string, leaseDuration time.Duration, workerID string) error {
+	if err := d.checkLease(collection, resource, workerID); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	now := d.opts.Clock()
+
+	l, ok, err := d.readLease(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if !ok || l.Owner != workerID || !now.Before(l.Expires) {
+		return ErrNotLeased
+	}
+
+	b, err := json.Marshal(lease{workerID, now.Add(leaseDuration)})
+	if err != nil {
+		return err
+	}
+
+	return d.writeFileAtomic(d.leasePath(collection, resource), b)
+}
+
+// Release gives up workerID's lease on a record, expired or not. It fails
+// with ErrNotLeased if the record isn't leased to the worker.
+func (d *Driver) Release(collection, resource, workerID string) error {
+	if err := d.checkLease(collection, resource, workerID); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	l, ok, err := d.readLease(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if !ok || l.Owner != workerID {
+		return ErrNotLeased
+	}
+
+	return os.Remove(d.leasePath(collection, resource))
+}
@@ -0,0 +1,42 @@
+package godb
+
+import "path/filepath"
+
+const lockFile = ".lock"
+
+// acquireLock takes the exclusive process lock on the database directory.
+//
+// On Unix systems this is an advisory flock(2) on ".lock": it is released
+// automatically if the process dies, but is only honoured by other processes
+// that also use ExclusiveLock, and it is unreliable on some network
+// filesystems (older NFS). On Windows the file is opened without sharing,
+// which the OS enforces for every process. Other platforms return an error.
+func (d *Driver) acquireLock() error {
+	release, err := lockPath(filepath.Join(d.dir, lockFile))
+	if err != nil {
+		return err
+	}
+
+	d.release = release
+	return nil
+}
+
+// Close releases the resources held by the driver, including the exclusive
+// lock taken when Options.ExclusiveLock is set. It first waits for the
+// writes queued by WriteAsync, after which WriteAsync fails with ErrClosed,
+// and stops keeping derived collections up to date.
+func (d *Driver) Close() error {
+	d.closeAsync()
+	d.stopDerived()
+
+	d.mutex.Lock()
+	release := d.release
+	d.release = nil
+	d.mutex.Unlock()
+
+	if release == nil {
+		return nil
+	}
+
+	return release()
+}
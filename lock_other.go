@@ -0,0 +1,13 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package godb
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func lockPath(path string) (func() error, error) {
+	return nil, fmt.Errorf("ExclusiveLock is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package godb
+
+import "syscall"
+
+const errorSharingViolation syscall.Errno = 32
+
+func lockPath(path string) (func() error, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A share mode of 0 denies every other open of the file until the
+	// handle is closed.
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+
+	return func() error {
+		return syscall.CloseHandle(h)
+	}, nil
+}
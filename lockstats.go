@@ -0,0 +1,58 @@
+package godb
+
+import "time"
+
+// LockStat summarises the waits for one collection's locks.
+type LockStat struct {
+	Count     int64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// lockWaitStart returns the time a lock wait starts, or the zero time when
+// Options.LockStats is off so that disabled instrumentation costs no clock
+// reads.
+func (d *Driver) lockWaitStart() time.Time {
+	if !d.opts.LockStats {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (d *Driver) recordLockWait(collection string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+
+	wait := time.Since(start)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stat, ok := d.lockStats[collection]
+	if !ok {
+		stat = &LockStat{}
+		d.lockStats[collection] = stat
+	}
+
+	stat.Count++
+	stat.TotalWait += wait
+	if wait > stat.MaxWait {
+		stat.MaxWait = wait
+	}
+}
+
+// LockStats reports, per collection, how many times its lock was acquired
+// and how long acquiring it took in total and at worst, counting shared and
+// exclusive holds alike. It is empty unless Options.LockStats is set.
+func (d *Driver) LockStats() map[string]LockStat {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats := make(map[string]LockStat, len(d.lockStats))
+	for collection, stat := range d.lockStats {
+		stats[collection] = *stat
+	}
+
+	return stats
+}
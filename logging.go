@@ -0,0 +1,68 @@
+package godb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Log levels passed to StructuredLogger.
+const (
+	LevelError = "error"
+	LevelWarn  = "warn"
+	LevelInfo  = "info"
+	LevelDebug = "debug"
+)
+
+// StructuredLogger can be implemented by an Options.Logger that accepts
+// key-value fields, e.g. an adapter for log/slog. The driver then passes
+// the message and its fields (always including "op", and "collection" and
+// "resource" where they apply) as is; other loggers get a single logfmt
+// line through their printf-style methods instead:
+//
+//	wrote record op=write collection=users resource=kamo path=users/kamo.json
+type StructuredLogger interface {
+	Log(level, msg string, keyvals ...interface{})
+}
+
+// logKV logs msg with keyvals, alternating keys and values.
+func (d *Driver) logKV(level, msg string, keyvals ...interface{}) {
+	if l, ok := d.log.(StructuredLogger); ok {
+		l.Log(level, msg, keyvals...)
+		return
+	}
+
+	line := logfmt(msg, keyvals)
+
+	switch level {
+	case LevelError:
+		d.log.Error("%s", line)
+	case LevelWarn:
+		d.log.Warn("%s", line)
+	case LevelDebug:
+		d.log.Debug("%s", line)
+	default:
+		d.log.Info("%s", line)
+	}
+}
+
+func logfmt(msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		s := fmt.Sprint(value)
+		if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+			s = strconv.Quote(s)
+		}
+
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+
+	return b.String()
+}
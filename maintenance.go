@@ -0,0 +1,383 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Compact rewrites every record in collection as minified JSON, keeping the
+// trailing newline, and reports how many bytes were saved. Records that are
+// already compact are left untouched. Under the Append write strategy it
+// also drops every version but the current one.
+func (d *Driver) Compact(collection string) (int64, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - nothing to compact!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	names, err := d.resources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	var saved int64
+
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err != nil {
+			return saved, err
+		}
+
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b); err != nil {
+			return saved, fmt.Errorf("Unable to compact '%s': %v", name, err)
+		}
+		compact := d.terminate(buf.Bytes())
+
+		if d.opts.WriteStrategy == Append {
+			path := d.recordPath(collection, name)
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				return saved, err
+			}
+
+			if int64(len(compact)) >= fi.Size() {
+				continue
+			}
+
+			if err := d.io(func() error { return d.writeFileAtomic(path, compact) }); err != nil {
+				return saved, err
+			}
+
+			d.cache.put(collection, name, compact)
+			saved += fi.Size() - int64(len(compact))
+			continue
+		}
+
+		if len(compact) >= len(b) {
+			continue
+		}
+
+		if err := d.writeRecord(collection, name, compact); err != nil {
+			return saved, err
+		}
+
+		saved += int64(len(b) - len(compact))
+	}
+
+	return saved, nil
+}
+
+// recoverTemps completes writes interrupted by a crash. A "<name>.json.tmp" whose
+// final file is missing, or isn't valid JSON, was written but never
+// renamed, so it is promoted if it holds valid JSON, or what looks like a
+// whole encrypted record; every other leftover temp file is removed.
+func (d *Driver) recoverTemps() error {
+	return filepath.Walk(d.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") && strings.HasSuffix(info.Name(), ".tmp") {
+				d.logKV(LevelInfo, "removing leftover temp directory", "op", "recover", "path", path)
+				if err := os.RemoveAll(path); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(path, ".json.tmp") {
+			return nil
+		}
+
+		final := strings.TrimSuffix(path, ".tmp")
+
+		// The final file can also be truncated if writeFileAtomic had to
+		// fall back to overwriting it in place.
+		if current, err := ioutil.ReadFile(final); os.IsNotExist(err) || err == nil && !wholeRecord(current) {
+			if b, err := ioutil.ReadFile(path); err == nil && wholeRecord(b) {
+				d.logKV(LevelInfo, "recovering interrupted write", "op", "recover", "path", final)
+				return d.writeFileAtomic(final, b)
+			}
+		}
+
+		d.logKV(LevelInfo, "removing leftover temp file", "op", "recover", "path", path)
+		return os.Remove(path)
+	})
+}
+
+// Canonicalize rewrites every record in collection in canonical form -
+// object keys sorted, tab indented, one trailing newline - so the files are
+// byte-stable regardless of which writer produced them. Numbers keep their
+// original formatting. It returns how many files changed.
+func (d *Driver) Canonicalize(collection string) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - nothing to canonicalize!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	names, err := d.resources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err != nil {
+			return changed, err
+		}
+
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return changed, fmt.Errorf("Unable to canonicalize '%s': %v", name, err)
+		}
+
+		canonical, err := json.MarshalIndent(doc, "", "\t")
+		if err != nil {
+			return changed, err
+		}
+		canonical = d.terminate(canonical)
+
+		if bytes.Equal(canonical, b) {
+			continue
+		}
+
+		if err := d.writeRecord(collection, name, canonical); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// Size reports the total size in bytes and the number of records across
+// every collection. Only record files count; hidden, metadata and temp
+// files are skipped.
+func (d *Driver) Size() (int64, int, error) {
+	collections, err := d.collections()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var total int64
+	var count int
+
+	for _, collection := range collections {
+		size, n, err := d.CollectionSize(collection)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		total += size
+		count += n
+	}
+
+	return total, count, nil
+}
+
+// CollectionSize reports the total size in bytes and the number of records
+// of one collection.
+func (d *Driver) CollectionSize(collection string) (int64, int, error) {
+	if collection == "" {
+		return 0, 0, fmt.Errorf("Missing collection - unable to measure!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, 0, err
+	}
+
+	files, err := d.recordFiles(collection)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var total int64
+	for _, file := range files {
+		total += file.Size()
+	}
+
+	return total, len(files), nil
+}
+
+// MapCollection passes every record of collection through fn under the
+// collection lock and writes back the result when it differs from the
+// stored bytes; returning nil from fn deletes the record instead. Results
+// must be valid JSON. It returns how many records were rewritten or
+// deleted, which makes it the building block for data migrations.
+func (d *Driver) MapCollection(collection string, fn func(data []byte) ([]byte, error)) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - nothing to transform!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	names, err := d.resources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	modified := 0
+
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err != nil {
+			return modified, err
+		}
+
+		out, err := fn(b)
+		if err != nil {
+			return modified, fmt.Errorf("Unable to transform '%s': %w", name, err)
+		}
+
+		if out == nil {
+			if err := d.delete(collection, name); err != nil {
+				return modified, err
+			}
+			modified++
+			continue
+		}
+
+		if !json.Valid(out) {
+			return modified, fmt.Errorf("Unable to transform '%s': result is not valid JSON", name)
+		}
+
+		out = d.terminate(out)
+
+		if bytes.Equal(out, b) {
+			continue
+		}
+
+		if err := d.writeRecord(collection, name, out); err != nil {
+			return modified, err
+		}
+		modified++
+	}
+
+	return modified, nil
+}
+
+// CollectionStats maps every collection to its number of records in one
+// pass over the database directory, applying the same rules as the other
+// counting methods: hidden directories and files, and temp files, are
+// skipped.
+func (d *Driver) CollectionStats() (map[string]int, error) {
+	collections, err := d.collections()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]int, len(collections))
+
+	for _, collection := range collections {
+		files, err := d.recordFiles(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		stats[collection] = len(files)
+	}
+
+	return stats, nil
+}
+
+// makeRoom evicts the least recently modified records of collection until
+// writing resource won't take it past Options.MaxRecordsPerCollection. The
+// caller must hold the collection lock.
+func (d *Driver) makeRoom(collection, resource string) error {
+	files, err := d.recordFiles(collection)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if d.resourceName(file.Name()) == resource {
+			return nil
+		}
+	}
+
+	excess := len(files) - d.opts.MaxRecordsPerCollection + 1
+	if excess <= 0 {
+		return nil
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	for _, file := range files[:excess] {
+		if err := d.delete(collection, d.resourceName(file.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Refresh reconciles the driver's in-memory state with the directory after
+// it was changed behind the driver's back, e.g. by restoring a backup: it
+// adds locks for collections that appeared, drops the locks of collections
+// that vanished unless they are in use, and forgets cached records,
+// collection configs and indexes so they are read from disk again.
+func (d *Driver) Refresh() error {
+	collections, err := d.collections()
+	if err != nil {
+		return err
+	}
+
+	onDisk := make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		onDisk[collection] = true
+	}
+
+	d.mutex.Lock()
+	for _, collection := range collections {
+		if _, ok := d.mutexes[collection]; !ok {
+			d.mutexes[collection] = &sync.RWMutex{}
+		}
+	}
+	for collection := range d.mutexes {
+		if !onDisk[collection] && d.mutexUsers[collection] == 0 {
+			delete(d.mutexes, collection)
+		}
+	}
+	d.configs = make(map[string]CollectionConfig)
+	d.versions = make(map[string]fileVersion)
+	d.mutex.Unlock()
+
+	d.cache.clear()
+	d.forgetIndexes("")
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// MergePolicy decides the record MergeCollections keeps when both
+// collections hold a resource, given the destination's and the source's raw
+// contents. Returning existing unchanged skips the record. SkipExisting and
+// Overwrite are the common policies.
+type MergePolicy func(existing, incoming []byte) ([]byte, error)
+
+// SkipExisting is a MergePolicy keeping the destination's record.
+func SkipExisting(existing, incoming []byte) ([]byte, error) {
+	return existing, nil
+}
+
+// Overwrite is a MergePolicy replacing the destination's record with the
+// source's.
+func Overwrite(existing, incoming []byte) ([]byte, error) {
+	return incoming, nil
+}
+
+// MergeResult counts what MergeCollections did with the source's records.
+type MergeResult struct {
+	Added       int
+	Overwritten int
+	Skipped     int
+}
+
+// MergeCollections copies the records of src into dst: records dst lacks
+// are added, and for records both have, policy picks the content dst keeps.
+// Records are read as ForEach does and stored byte for byte, like
+// CopyCollectionTo, except that what policy returns is checked and stamped
+// as a Write of it would be: it must be valid JSON and pass dst's schema.
+// The whole merge runs under dst's collection lock and a read lock on src,
+// taken in name order like every lock on more than one collection, so
+// nothing else writes either meanwhile and merges in opposite directions
+// can't deadlock; src is left untouched. On error the result counts the
+// records merged so far.
+func (d *Driver) MergeCollections(dst, src string, policy MergePolicy) (MergeResult, error) {
+	var result MergeResult
+
+	if dst == "" || src == "" {
+		return result, fmt.Errorf("Missing collection - unable to merge!")
+	}
+
+	if dst == src {
+		return result, fmt.Errorf("Unable to merge '%s' into itself!", src)
+	}
+
+	if policy == nil {
+		return result, fmt.Errorf("Missing merge policy - unable to merge '%s' into '%s'!", src, dst)
+	}
+
+	if err := d.validateNames(dst, src); err != nil {
+		return result, err
+	}
+
+	if err := d.authorize(OperationList, src, ""); err != nil {
+		return result, err
+	}
+
+	if src < dst {
+		runlock := d.rlockCollection(src)
+		defer runlock()
+	}
+
+	unlock := d.lockCollection(dst)
+	defer unlock()
+
+	if dst < src {
+		runlock := d.rlockCollection(src)
+		defer runlock()
+	}
+
+	names, err := d.resources(src)
+	if err != nil {
+		return result, err
+	}
+
+	for _, resource := range names {
+		incoming, err := d.readRecord(src, resource)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if err := d.mergeRecord(dst, resource, incoming, policy, &result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// mergeRecord merges one record of the source into dst, under dst's lock.
+func (d *Driver) mergeRecord(dst, resource string, incoming []byte, policy MergePolicy, result *MergeResult) error {
+	if err := d.checkWrite(dst, resource); err != nil {
+		return err
+	}
+
+	b := incoming
+
+	existing, err := d.readRecord(dst, resource)
+	exists := err == nil
+	switch {
+	case err == ErrNotFound:
+	case err != nil:
+		return err
+	default:
+		if b, err = policy(existing, incoming); err != nil {
+			return fmt.Errorf("Unable to merge '%s' into '%s': %w", resource, dst, err)
+		}
+		if bytes.Equal(b, existing) {
+			result.Skipped++
+			return nil
+		}
+		if d.jsonRecords() && !json.Valid(b) {
+			return fmt.Errorf("Unable to merge '%s' into '%s' - the result is not valid JSON!", resource, dst)
+		}
+		if b, err = d.prepare(dst, resource, b); err != nil {
+			return fmt.Errorf("Unable to merge '%s' into '%s': %w", resource, dst, err)
+		}
+	}
+
+	if d.opts.MaxRecordsPerCollection > 0 {
+		if err := d.makeRoom(dst, resource); err != nil {
+			return err
+		}
+	}
+
+	if err := d.writeRecord(dst, resource, b); err != nil {
+		return fmt.Errorf("Unable to merge '%s' into '%s': %w", resource, dst, err)
+	}
+
+	if exists {
+		result.Overwritten++
+	} else {
+		result.Added++
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeCollectionsOppositeDirections(t *testing.T) {
+	// Listing the source is slow, so both merges are well under way when
+	// they reach for the other collection.
+	db, err := New(t.TempDir(), &Options{
+		Authorize: func(op Operation, collection, resource string) error {
+			if op == OperationList {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := db.Write("a", fmt.Sprintf("a%d", i), map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Write("b", fmt.Sprintf("b%d", i), map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := db.MergeCollections("b", "a", SkipExisting)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := db.MergeCollections("a", "b", SkipExisting)
+			errs <- err
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("merges in opposite directions deadlocked")
+	}
+
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, collection := range []string{"a", "b"} {
+		var records []map[string]int
+		if err := db.ReadAll(collection, &records); err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 40 {
+			t.Errorf("%s has %d records after merging, want 40", collection, len(records))
+		}
+	}
+}
+
+func TestMergePolicyResultIsChecked(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := &Schema{Type: "object", Required: []string{"name"}}
+	if err := db.ConfigureCollection("dst", CollectionConfig{Schema: schema}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("dst", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("src", "kamo", map[string]string{"name": "Kamogelo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []MergePolicy{
+		func(existing, incoming []byte) ([]byte, error) { return []byte(`{"name":`), nil },
+		func(existing, incoming []byte) ([]byte, error) { return []byte(`{"age":3}`), nil },
+	} {
+		if _, err := db.MergeCollections("dst", "src", policy); err == nil {
+			t.Fatal("MergeCollections stored an invalid policy result")
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "dst", "kamo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n\t\"name\": \"Kamo\"\n}\n"; string(b) != want {
+		t.Fatalf("dst/kamo = %q, want %q", b, want)
+	}
+}
@@ -0,0 +1,61 @@
+package godb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// CollectionHash returns the checksum of every record of collection, keyed
+// by resource name, and the root of a Merkle tree over them, so two copies
+// of a collection can be compared cheaply: equal roots mean equal
+// collections, and otherwise comparing leaves tells which records differ.
+// Records are read one at a time, as ForEach does.
+//
+// Each leaf of the tree is the SHA-256 of a record's name, a zero byte and
+// its checksum, in byte-wise order of name; each node is the SHA-256 of
+// its two children, an odd node out being carried up unchanged. The root
+// of an empty collection is the SHA-256 of nothing. Hashes are hex encoded.
+func (d *Driver) CollectionHash(collection string) (string, map[string]string, error) {
+	leaves := make(map[string]string)
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		leaves[resource] = checksum(data)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	names := make([]string, 0, len(leaves))
+	for name := range leaves {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	level := make([][]byte, len(names))
+	for i, name := range names {
+		sum := sha256.Sum256([]byte(name + "\x00" + leaves[name]))
+		level[i] = sum[:]
+	}
+
+	if len(level) == 0 {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:]), leaves, nil
+	}
+
+	for len(level) > 1 {
+		next := level[:0]
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			sum := sha256.Sum256(append(append([]byte(nil), level[i]...), level[i+1]...))
+			next = append(next, sum[:])
+		}
+		level = next
+	}
+
+	return hex.EncodeToString(level[0]), leaves, nil
+}
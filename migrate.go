@@ -0,0 +1,103 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const versionFile = ".version"
+
+// Migration upgrades the on-disk data by one schema version.
+type Migration func(d *Driver) error
+
+// RegisterMigration registers fn as the migration to schema version. Versions
+// are positive and unique; Migrate runs them in ascending order.
+func (d *Driver) RegisterMigration(version int, fn Migration) error {
+	if version <= 0 {
+		return fmt.Errorf("Invalid migration version %d - versions start at 1!", version)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.migrations == nil {
+		d.migrations = make(map[int]Migration)
+	}
+
+	if _, ok := d.migrations[version]; ok {
+		return fmt.Errorf("Migration %d is already registered!", version)
+	}
+
+	d.migrations[version] = fn
+	return nil
+}
+
+// SchemaVersion returns the schema version recorded in ".version" at the
+// database root, or 0 for a database that has never been migrated.
+func (d *Driver) SchemaVersion() (int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(d.dir, versionFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid schema version file: %v", err)
+	}
+
+	return version, nil
+}
+
+// Migrate runs every registered migration newer than the recorded schema
+// version, in order, recording the version after each one succeeds.
+// Already-applied migrations are skipped, so Migrate is safe to call on
+// every start. If a migration fails, Migrate stops and the recorded
+// version is that of the last migration that succeeded.
+func (d *Driver) Migrate() error {
+	d.migrateMu.Lock()
+	defer d.migrateMu.Unlock()
+
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	var versions []int
+	for version := range d.migrations {
+		if version > current {
+			versions = append(versions, version)
+		}
+	}
+	d.mutex.Unlock()
+
+	sort.Ints(versions)
+
+	for _, version := range versions {
+		d.mutex.Lock()
+		fn := d.migrations[version]
+		d.mutex.Unlock()
+
+		d.logKV(LevelInfo, "migrating schema", "op", "migrate", "from", current, "to", version)
+
+		if err := fn(d); err != nil {
+			return fmt.Errorf("Migration %d failed (schema remains at version %d): %w", version, current, err)
+		}
+
+		if err := d.writeFileAtomic(filepath.Join(d.dir, versionFile), []byte(strconv.Itoa(version)+"\n")); err != nil {
+			return err
+		}
+
+		current = version
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// A mirror is a second copy of the database, typically on another disk,
+// kept in step synchronously: every record the driver stores or deletes is
+// stored or deleted in Options.MirrorDir too, byte for byte, before the
+// operation returns. This covers Write and everything built on it, Delete,
+// Insert, patches, Pop, evictions, Swap and Thaw.
+//
+// The primary is always updated first, along with everything the driver
+// keeps about it - cache, indexes, quotas - and subscribers are told. If
+// the mirror then fails, the operation returns an error saying so but the
+// primary change stands; with Options.MirrorBestEffort the failure is only
+// logged. Either way, the mirror has diverged until the record is written
+// again. Operations that move files around rather than storing records -
+// ReplaceCollection, Rotate, Freeze, the maintenance methods and collection
+// configs - are not mirrored, nor are lease files; copy the directory again
+// after using them. A crash between the two updates leaves
+// the mirror one change behind.
+
+// newMirror opens the driver writing to Options.MirrorDir. It stores the
+// bytes the primary has already prepared, so everything that transforms or
+// checks records is switched off.
+func newMirror(opts Options) *Driver {
+	if opts.MirrorDir == "" {
+		return nil
+	}
+
+	dir := opts.MirrorDir
+
+	opts.MirrorDir = ""
+	opts.ReadReplicas = nil
+	opts.Authorize = nil
+	opts.CacheSize = 0
+	opts.OnConflict = nil
+	opts.TraceOps = false
+	opts.CollectionQuota = nil
+
+	return newDriver(filepath.Clean(dir), opts)
+}
+
+// mirrorOp applies fn to the mirror, if there is one.
+func (d *Driver) mirrorOp(op, collection, resource string, fn func(m *Driver) error) error {
+	if d.mirror == nil {
+		return nil
+	}
+
+	err := fn(d.mirror)
+	if err == nil {
+		return nil
+	}
+
+	if d.opts.MirrorBestEffort {
+		d.logKV(LevelError, "unable to update mirror", "op", op, "collection", collection, "resource", resource, "error", err)
+		return nil
+	}
+
+	return fmt.Errorf("Unable to mirror %s of '%s' in '%s' - the mirror has diverged: %w", op, resource, collection, err)
+}
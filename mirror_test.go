@@ -0,0 +1,52 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFailedMirrorLeavesDriverInStep(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file where the mirror's directory should be makes every mirrored
+	// write fail.
+	mirror := filepath.Join(t.TempDir(), "mirror")
+	if err := os.WriteFile(mirror, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(dir, &Options{CacheSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "kamo", map[string]int{"v": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex("users", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := db.opts
+	opts.MirrorDir = mirror
+	db.mirror = newMirror(opts)
+
+	var got map[string]int
+	if err := db.Read("users", "kamo", &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]int{"v": 2}); err == nil {
+		t.Fatal("Write with a failing mirror succeeded")
+	}
+
+	if err := db.Read("users", "kamo", &got); err != nil || got["v"] != 2 {
+		t.Fatalf("Read after a failed mirror = %v, %v, want v 2", got, err)
+	}
+
+	var found []map[string]int
+	if err := db.FindBy("users", "v", 2, &found); err != nil || !reflect.DeepEqual(found, []map[string]int{{"v": 2}}) {
+		t.Fatalf("FindBy v 2 after a failed mirror = %v, %v", found, err)
+	}
+}
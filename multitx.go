@@ -0,0 +1,181 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MultiTx gives the function run by Atomic access to the collections it
+// locked. Its methods must only be called from that function.
+type MultiTx struct {
+	d         *Driver
+	scope     map[string]bool
+	preimages []preimage
+	touched   map[string]bool
+}
+
+// preimage is a record as it was before a transaction first changed it.
+type preimage struct {
+	collection, resource string
+	data                 []byte
+	existed              bool
+}
+
+// Atomic runs fn with exclusive locks on the named collections, so fn sees
+// and leaves them in a consistent state, e.g. to move a balance between
+// accounts kept in different collections. If fn returns an error, every
+// record it wrote or deleted through tx is restored to its prior contents
+// before Atomic returns the error.
+//
+// The locks are taken in sorted order of collection name, which every
+// other method locking several collections follows too, so two Atomic
+// calls over overlapping collections can't deadlock. fn must not call the
+// driver's own methods on the locked collections - they would wait for the
+// locks fn holds - and only sees changes made by other processes if they
+// happen before it reads. Restoring is best effort: a crash mid-rollback
+// leaves the collections partly updated.
+func (d *Driver) Atomic(collections []string, fn func(tx *MultiTx) error) error {
+	if len(collections) == 0 {
+		return fmt.Errorf("Missing collection - nothing to lock!")
+	}
+
+	scope := make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		if collection == "" {
+			return fmt.Errorf("Missing collection - unable to lock (no name)!")
+		}
+
+		if err := d.validateNames(collection); err != nil {
+			return err
+		}
+
+		scope[collection] = true
+	}
+
+	sorted := make([]string, 0, len(scope))
+	for collection := range scope {
+		sorted = append(sorted, collection)
+	}
+	sort.Strings(sorted)
+
+	for _, collection := range sorted {
+		unlock := d.lockCollection(collection)
+		defer unlock()
+	}
+
+	tx := &MultiTx{d: d, scope: scope, touched: make(map[string]bool)}
+
+	err := fn(tx)
+	if err == nil {
+		return nil
+	}
+
+	if rerr := tx.rollback(); rerr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+	}
+
+	return err
+}
+
+func (tx *MultiTx) check(collection, resource string) error {
+	if !tx.scope[collection] {
+		return fmt.Errorf("Unable to access collection '%s' - it isn't locked by this transaction!", collection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to access record (no name)!")
+	}
+
+	return tx.d.validateNames(resource)
+}
+
+// remember saves a record's preimage the first time tx changes it.
+func (tx *MultiTx) remember(collection, resource string) error {
+	key := tx.d.recordKey(collection, resource)
+	if tx.touched[key] {
+		return nil
+	}
+
+	b, err := tx.d.readRecord(collection, resource)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	tx.touched[key] = true
+	tx.preimages = append(tx.preimages, preimage{collection, resource, b, err == nil})
+	return nil
+}
+
+func (tx *MultiTx) rollback() error {
+	var first error
+
+	for i := len(tx.preimages) - 1; i >= 0; i-- {
+		p := tx.preimages[i]
+
+		var err error
+		if p.existed {
+			err = tx.d.writeRecord(p.collection, p.resource, p.data)
+		} else if _, serr := tx.d.statRecord(p.collection, p.resource); serr == nil {
+			err = tx.d.delete(p.collection, p.resource)
+		}
+
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Read reads a record of one of the transaction's collections into v.
+func (tx *MultiTx) Read(collection, resource string, v interface{}) error {
+	if err := tx.check(collection, resource); err != nil {
+		return err
+	}
+
+	if err := tx.d.authorize(OperationRead, collection, resource); err != nil {
+		return err
+	}
+
+	b, err := tx.d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	return tx.d.decode(collection, resource, b, v)
+}
+
+// Write writes v to a record of one of the transaction's collections, as
+// Write would.
+func (tx *MultiTx) Write(collection, resource string, v interface{}) error {
+	if err := tx.check(collection, resource); err != nil {
+		return err
+	}
+
+	if err := tx.d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	if err := tx.remember(collection, resource); err != nil {
+		return err
+	}
+
+	return tx.d.write(collection, resource, v)
+}
+
+// Delete deletes a record of one of the transaction's collections.
+func (tx *MultiTx) Delete(collection, resource string) error {
+	if err := tx.check(collection, resource); err != nil {
+		return err
+	}
+
+	if err := tx.d.authorize(OperationDelete, collection, resource); err != nil {
+		return err
+	}
+
+	if err := tx.remember(collection, resource); err != nil {
+		return err
+	}
+
+	return tx.d.delete(collection, resource)
+}
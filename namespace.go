@@ -0,0 +1,44 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Namespace returns a driver rooted at the sub-directory name of d, with its
+// own locks and per-collection state, so tenants can use the same collection
+// names without colliding. Names are validated like collection names, so a
+// namespaced driver can never reach outside its directory. The namespace
+// directory lives alongside d's collections; don't reuse a collection name.
+// Read replicas and the mirror are namespaced the same way; the namespaced
+// driver shares d's fencing epoch.
+func (d *Driver) Namespace(name string) (*Driver, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Missing namespace - no place to root the driver!")
+	}
+
+	if err := d.validateNames(name); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(d.dir, d.encodeKey(name))
+
+	if err := d.mkdirAll(dir); err != nil {
+		return nil, err
+	}
+
+	opts := d.opts
+	opts.ReadReplicas = make([]string, len(d.opts.ReadReplicas))
+	for i, replica := range d.opts.ReadReplicas {
+		opts.ReadReplicas[i] = filepath.Join(replica, d.encodeKey(name))
+	}
+
+	if opts.MirrorDir != "" {
+		opts.MirrorDir = filepath.Join(opts.MirrorDir, d.encodeKey(name))
+	}
+
+	ns := newDriver(dir, opts)
+	ns.fence = d.fence
+
+	return ns, nil
+}
@@ -0,0 +1,93 @@
+package godb
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const opsLogFile = "_ops.log"
+
+const (
+	OpWrite   = "write"
+	OpDelete  = "delete"
+	OpSwap    = "swap"
+	OpReplace = "replace"
+	OpAppend  = "append"
+	OpRotate  = "rotate"
+	OpRename  = "rename"
+)
+
+// OpRecord is one line of the operations log.
+type OpRecord struct {
+	Time       time.Time `json:"time"`
+	Op         string    `json:"op"`
+	Collection string    `json:"collection"`
+	Resource   string    `json:"resource,omitempty"`
+	Bytes      int       `json:"bytes"`
+}
+
+// trace publishes an operation to subscribers and appends an entry to the
+// operations log when Options.TraceOps is set. The log is an audit aid, so
+// failing to write it is logged rather than failing the operation that has
+// already happened.
+func (d *Driver) trace(op, collection, resource string, n int) {
+	resource = d.foldKey(resource)
+	d.events.publish(op, collection, resource)
+	d.noteChange(collection)
+
+	if !d.opts.TraceOps {
+		return
+	}
+
+	b, err := json.Marshal(OpRecord{d.opts.Clock().UTC(), op, collection, resource, n})
+	if err != nil {
+		d.logKV(LevelError, "unable to encode ops log entry", "op", op, "collection", collection, "resource", resource, "error", err)
+		return
+	}
+
+	d.opsMu.Lock()
+	defer d.opsMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(d.dir, opsLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		d.logKV(LevelError, "unable to open ops log", "op", op, "collection", collection, "resource", resource, "error", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, byte('\n'))); err != nil {
+		d.logKV(LevelError, "unable to append to ops log", "op", op, "collection", collection, "resource", resource, "error", err)
+	}
+}
+
+// OpsLog returns every entry of the operations log in the order it was
+// written. A database that never traced anything has an empty log.
+func (d *Driver) OpsLog() ([]OpRecord, error) {
+	d.opsMu.Lock()
+	defer d.opsMu.Unlock()
+
+	f, err := os.Open(filepath.Join(d.dir, opsLogFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []OpRecord
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec OpRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
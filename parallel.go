@@ -0,0 +1,66 @@
+package godb
+
+import "sync"
+
+// parallel calls fn for every index in [0, n) from up to
+// Options.ReadConcurrency goroutines and returns the error of the lowest
+// failing index, so the outcome doesn't depend on scheduling. Once an index
+// fails no new ones are started.
+func (d *Driver) parallel(n int, fn func(i int) error) error {
+	workers := d.opts.ReadConcurrency
+	if workers > n {
+		workers = n
+	}
+
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+	indexes := make(chan int)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if errs[i] = fn(i); errs[i] != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func writeNumbered(tb testing.TB, dir string, n int) {
+	tb.Helper()
+
+	db, err := New(dir, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := db.Write("items", fmt.Sprintf("item%04d", i), map[string]int{"n": i}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestReadConcurrencyKeepsResults(t *testing.T) {
+	dir := t.TempDir()
+	writeNumbered(t, dir, 200)
+
+	var want []map[string]int
+	var wantRaw map[string]json.RawMessage
+
+	for _, concurrency := range []int{0, 1, 2, 8, 64, 500} {
+		db, err := New(dir, &Options{ReadConcurrency: concurrency})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []map[string]int
+		if err := db.ReadAll("items", &got); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := db.ReadAllRawMap("items")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want == nil {
+			want, wantRaw = got, raw
+			if len(want) != 200 {
+				t.Fatalf("ReadAll returned %d records, want 200", len(want))
+			}
+			for i, r := range want {
+				if r["n"] != i {
+					t.Fatalf("ReadAll record %d is %v, out of order", i, r)
+				}
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadConcurrency %d: ReadAll differs from sequential reads", concurrency)
+		}
+		if !reflect.DeepEqual(raw, wantRaw) {
+			t.Errorf("ReadConcurrency %d: ReadAllRawMap differs from sequential reads", concurrency)
+		}
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	dir := b.TempDir()
+	writeNumbered(b, dir, 1000)
+
+	for _, concurrency := range []int{1, 8} {
+		name := "serial"
+		if concurrency > 1 {
+			name = fmt.Sprintf("parallel%d", concurrency)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			db, err := New(dir, &Options{ReadConcurrency: concurrency})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for i := 0; i < b.N; i++ {
+				var records []map[string]int
+				if err := db.ReadAll("items", &records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
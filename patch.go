@@ -0,0 +1,418 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MergePatch applies an RFC 7386 JSON Merge Patch to a stored record under
+// the collection lock: objects merge recursively, null removes a key, and
+// any non-object patch value (including a top-level scalar or array)
+// replaces the target outright.
+//
+// The patched record is re-encoded with its object keys sorted and its
+// numbers written exactly as stored, so the same content always yields the
+// same bytes; a patch that changes nothing leaves the file untouched.
+func (d *Driver) MergePatch(collection, resource string, patch []byte) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	p, err := decodeDocument(patch)
+	if err != nil {
+		return fmt.Errorf("Invalid merge patch: %v", err)
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return err
+	}
+
+	patched := mergePatch(deepCopy(doc), p)
+	if jsonEqual(patched, doc) {
+		return nil
+	}
+
+	return d.write(collection, resource, patched)
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+
+	return t
+}
+
+// decodeDocument decodes JSON into generic maps and slices, keeping numbers
+// as json.Number so re-encoding doesn't change their formatting.
+func decodeDocument(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyPatch applies an RFC 6902 JSON Patch - an array of add, remove,
+// replace, move, copy and test operations - to a stored record under the
+// collection lock. Operations apply in order to the decoded document, and
+// the result is only written once every operation has succeeded, so a
+// failing operation (a failed test returns ErrPatchTestFailed) leaves the
+// record unchanged. Like MergePatch, it writes byte-stable output and skips
+// patches that don't change the document.
+func (d *Driver) ApplyPatch(collection, resource string, ops []byte) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	var patch []patchOp
+	if err := json.Unmarshal(ops, &patch); err != nil {
+		return fmt.Errorf("Invalid JSON patch: %v", err)
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return err
+	}
+
+	original := deepCopy(doc)
+
+	for i, op := range patch {
+		if doc, err = applyOp(doc, op); err != nil {
+			return fmt.Errorf("JSON patch operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	if jsonEqual(doc, original) {
+		return nil
+	}
+
+	return d.write(collection, resource, doc)
+}
+
+func applyOp(doc interface{}, op patchOp) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("missing value")
+		}
+		if value, err = decodeDocument(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, value)
+	case "remove":
+		return pointerRemove(doc, path)
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerSet(doc, path, value)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			return pointerAdd(doc, path, deepCopy(v))
+		}
+
+		if isPrefix(from, path) && len(from) < len(path) {
+			return nil, fmt.Errorf("cannot move a value into one of its children")
+		}
+
+		if doc, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "test":
+		v, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", p)
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("cannot traverse into %q of a scalar", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerSet replaces the value at an existing location and returns the
+// (possibly new) document root.
+func pointerSet(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	key := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[key] = value
+	case []interface{}:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = value
+	default:
+		return nil, fmt.Errorf("cannot set %q on a scalar", key)
+	}
+
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	key := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[key] = value
+		return doc, nil
+	case []interface{}:
+		i := len(c)
+		if key != "-" {
+			if i, err = arrayIndex(key, len(c)); err != nil {
+				return nil, err
+			}
+		}
+
+		grown := make([]interface{}, 0, len(c)+1)
+		grown = append(grown, c[:i]...)
+		grown = append(grown, value)
+		grown = append(grown, c[i:]...)
+		return pointerSet(doc, path[:len(path)-1], grown)
+	}
+
+	return nil, fmt.Errorf("cannot add %q to a scalar", key)
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the document root")
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	key := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := c[key]; !ok {
+			return nil, fmt.Errorf("path member %q not found", key)
+		}
+		delete(c, key)
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+
+		shrunk := append(append([]interface{}{}, c[:i]...), c[i+1:]...)
+		return pointerSet(doc, path[:len(path)-1], shrunk)
+	}
+
+	return nil, fmt.Errorf("cannot remove %q from a scalar", key)
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	return i, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+		for k, e := range c {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(c))
+		for i, e := range c {
+			s[i] = deepCopy(e)
+		}
+		return s
+	}
+
+	return v
+}
+
+// jsonEqual compares decoded documents, treating numbers that differ only
+// in formatting (1 and 1.0) as equal.
+func jsonEqual(a, b interface{}) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		return errA == nil && errB == nil && fa == fb
+	}
+
+	switch ca := a.(type) {
+	case map[string]interface{}:
+		cb, ok := b.(map[string]interface{})
+		if !ok || len(ca) != len(cb) {
+			return false
+		}
+		for k, v := range ca {
+			if w, ok := cb[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		cb, ok := b.([]interface{})
+		if !ok || len(ca) != len(cb) {
+			return false
+		}
+		for i := range ca {
+			if !jsonEqual(ca[i], cb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
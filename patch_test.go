@@ -0,0 +1,114 @@
+package godb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPatchOutputIsByteStable(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type item struct {
+		Name  string          `json:"name"`
+		Price json.RawMessage `json:"price"`
+		Tags  map[string]int  `json:"tags"`
+	}
+
+	// Struct field order, not key order, and a number with a trailing zero.
+	if err := db.Write("items", "patched", item{"pen", json.RawMessage("1.50"), map[string]int{"z": 1, "a": 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MergePatch("items", "patched", []byte(`{"stock":3}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("items", "written", json.RawMessage(`{"tags":{"a":2,"z":1},"stock":2,"price":1.50,"name":"pen"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyPatch("items", "written", []byte(`[{"op":"replace","path":"/stock","value":3}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := os.ReadFile(filepath.Join(dir, "items", "patched.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(filepath.Join(dir, "items", "written.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+	"name": "pen",
+	"price": 1.50,
+	"stock": 3,
+	"tags": {
+		"a": 2,
+		"z": 1
+	}
+}
+`
+	if string(patched) != want {
+		t.Errorf("MergePatch wrote %q, want %q", patched, want)
+	}
+	if string(written) != want {
+		t.Errorf("ApplyPatch wrote %q, want %q", written, want)
+	}
+}
+
+func TestNoOpPatchLeavesFileUntouched(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{Timestamps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]interface{}{"name": "Kamo", "age": 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "users", "kamo.json")
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, patch := range []func() error{
+		func() error { return db.MergePatch("users", "kamo", []byte(`{}`)) },
+		func() error { return db.MergePatch("users", "kamo", []byte(`{"name":"Kamo","age":30.0}`)) },
+		func() error {
+			return db.ApplyPatch("users", "kamo", []byte(`[{"op":"test","path":"/name","value":"Kamo"},{"op":"replace","path":"/age","value":30}]`))
+		},
+	} {
+		if err := patch(); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !fi.ModTime().Equal(old) {
+			t.Errorf("no-op patch changed the mod time to %v", fi.ModTime())
+		}
+		if string(after) != string(before) {
+			t.Errorf("no-op patch rewrote the record:\n%s\nwas\n%s", after, before)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package godb
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathStrategy decides where collections and records live, relative to the
+// database directory.
+//
+// Methods that list a collection (ReadAll, ForEach and friends) look for
+// "<resource>.json" files directly inside CollectionDir, so a RecordPath
+// that places records elsewhere still supports reads, writes and deletes of
+// individual records but hides them from listings. With a Codec other than
+// JSONCodec, the ".json" suffix of RecordPath is replaced by the codec's
+// extension.
+type PathStrategy interface {
+	CollectionDir(collection string) string
+	RecordPath(collection, resource string) string
+}
+
+// DefaultLayout stores each record as "<collection>/<resource>.json".
+type DefaultLayout struct{}
+
+func (DefaultLayout) CollectionDir(collection string) string {
+	return collection
+}
+
+func (DefaultLayout) RecordPath(collection, resource string) string {
+	return filepath.Join(collection, resource+".json")
+}
+
+// collectionDir and recordPath hand the strategy names already passed
+// through Options.KeyEncoder.
+func (d *Driver) collectionDir(collection string) string {
+	return filepath.Join(d.dir, d.opts.PathStrategy.CollectionDir(d.encodeKey(collection)))
+}
+
+func (d *Driver) recordPath(collection, resource string) string {
+	return d.recordPathExt(collection, resource, d.ext())
+}
+
+// recordPathExt is recordPath for a record stored with extension ext.
+func (d *Driver) recordPathExt(collection, resource, ext string) string {
+	path := d.opts.PathStrategy.RecordPath(d.encodeKey(collection), d.encodeResource(resource))
+	if ext != ".json" {
+		path = strings.TrimSuffix(path, ".json") + ext
+	}
+	return filepath.Join(d.dir, path)
+}
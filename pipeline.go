@@ -0,0 +1,77 @@
+package godb
+
+import "fmt"
+
+// Options.ReadPipeline and Options.WritePipeline transform a record's bytes
+// on their way from and to disk, with step i of WritePipeline meant to
+// undo step i of ReadPipeline: a write runs WritePipeline from its last
+// step to its first, and a read runs ReadPipeline from its first step to
+// its last, so with
+//
+//	ReadPipeline:  [decompress, decrypt, upgrade]
+//	WritePipeline: [compress, encrypt, identity]
+//
+// a record is encrypted and then compressed when written, and decompressed
+// and then decrypted when read. The pipelines may differ in length; a read
+// step without a write step, like upgrade above, transforms what older
+// writers stored. Built-in encryption (EncryptionKey) wraps the outside of
+// the pipeline. Everything above storage - the cache, events, Read,
+// ReadAll, ForEach and the rest - sees the record itself.
+//
+// A failing step fails the read or write, naming the pipeline, the step's
+// index, the resource and the collection, and wrapping the step's error.
+// Since stored bytes can be anything, pipelines can't be combined with
+// Exploded, the Append write strategy or QuarantineCorrupt, and
+// CheckStructure and RecoverOnOpen see transformed records as not being
+// valid JSON.
+
+func checkPipelines(opts Options) error {
+	if len(opts.ReadPipeline) == 0 && len(opts.WritePipeline) == 0 {
+		return nil
+	}
+
+	switch {
+	case opts.Exploded:
+		return fmt.Errorf("Invalid pipelines - exploded storage needs the stored bytes to be JSON!")
+	case opts.WriteStrategy == Append:
+		return fmt.Errorf("Invalid pipelines - the %v write strategy needs the stored bytes to be JSON!", Append)
+	case opts.QuarantineCorrupt:
+		return fmt.Errorf("Invalid pipelines - QuarantineCorrupt needs the stored bytes to be JSON!")
+	}
+
+	for i, step := range opts.ReadPipeline {
+		if step == nil {
+			return fmt.Errorf("Invalid pipelines - read step %d is nil!", i)
+		}
+	}
+
+	for i, step := range opts.WritePipeline {
+		if step == nil {
+			return fmt.Errorf("Invalid pipelines - write step %d is nil!", i)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) runReadPipeline(collection, resource string, b []byte) ([]byte, error) {
+	for i, step := range d.opts.ReadPipeline {
+		var err error
+		if b, err = step(b); err != nil {
+			return nil, fmt.Errorf("Unable to read '%s' in '%s' - read pipeline step %d: %w", resource, collection, i, err)
+		}
+	}
+
+	return b, nil
+}
+
+func (d *Driver) runWritePipeline(collection, resource string, b []byte) ([]byte, error) {
+	for i := len(d.opts.WritePipeline) - 1; i >= 0; i-- {
+		var err error
+		if b, err = d.opts.WritePipeline[i](b); err != nil {
+			return nil, fmt.Errorf("Unable to write '%s' in '%s' - write pipeline step %d: %w", resource, collection, i, err)
+		}
+	}
+
+	return b, nil
+}
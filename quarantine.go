@@ -0,0 +1,80 @@
+package godb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const quarantineDir = ".quarantine"
+
+// quarantine moves a corrupt record out of its collection. The record is
+// re-checked under the collection lock, so one that was rewritten since it
+// was read is left alone.
+func (d *Driver) quarantine(collection, resource string) error {
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	path := d.recordPath(collection, resource)
+	if d.opts.Exploded {
+		path = d.explodedDir(collection, resource)
+	}
+
+	b, err := d.loadRecord(collection, resource)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || json.Valid(b) {
+		return err
+	}
+
+	dir := filepath.Join(d.dir, quarantineDir, d.encodeKey(collection))
+	if err := d.mkdirAll(dir); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, filepath.Join(dir, d.encodeResource(resource)+d.ext())); err != nil {
+		return err
+	}
+
+	d.cache.remove(collection, resource)
+	d.logKV(LevelWarn, "quarantined corrupt record", "op", "quarantine", "collection", collection, "resource", resource)
+	return nil
+}
+
+// ListQuarantine returns the quarantined records as "collection/resource"
+// names, sorted.
+func (d *Driver) ListQuarantine() ([]string, error) {
+	root := filepath.Join(d.dir, quarantineDir)
+
+	collections, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, collection := range collections {
+		if !collection.IsDir() {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(root, collection.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if strings.HasSuffix(file.Name(), d.ext()) {
+				names = append(names, d.decodeKey(collection.Name())+"/"+d.resourceName(file.Name()))
+			}
+		}
+	}
+
+	return names, nil
+}
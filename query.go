@@ -0,0 +1,309 @@
+package godb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Query filters, sorts and pages the records of a collection. Build one
+// with Driver.Query and run it with Run, All or Count; a Query is not safe
+// for concurrent use while it is being built.
+//
+// A Query streams its collection as ForEach does, decoding each record
+// once to test it, so only the matching records are held in memory - and
+// none beyond Offset plus Limit when the query isn't sorted, since it then
+// stops reading as soon as it has them. Sorting needs every match first.
+//
+// Fields are dotted paths as in Project. Values are compared as JSON:
+// Where's value is marshaled and read back, so numbers compare by value
+// whatever their Go type and formatting, and a struct matches the object
+// it would be written as. "<", "<=", ">" and ">=" order numbers, strings
+// and booleans (false first) and are false across types or for a missing
+// field; "!=" is true for a missing field.
+type Query struct {
+	d          *Driver
+	collection string
+	conds      []queryCond
+	sortField  string
+	desc       bool
+	offset     int
+	limit      int
+	err        error
+}
+
+type queryCond struct {
+	field string
+	op    string
+	value interface{}
+}
+
+// errQueryDone stops a query's ForEach once it has enough records.
+var errQueryDone = errors.New("query done")
+
+// Query starts a query over every record of collection, in ReadOrder.
+func (d *Driver) Query(collection string) *Query {
+	return &Query{d: d, collection: collection}
+}
+
+// Where keeps only the records whose field compares to value by op, one of
+// "=", "!=", "<", "<=", ">" and ">=". Several Wheres must all hold.
+func (q *Query) Where(field, op string, value interface{}) *Query {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+	default:
+		q.fail(fmt.Errorf("Invalid query - unknown operator %q!", op))
+		return q
+	}
+
+	b, err := json.Marshal(value)
+	if err == nil {
+		value, err = decodeDocument(b)
+	}
+	if err != nil {
+		q.fail(fmt.Errorf("Invalid query - unable to compare %s with %T: %v", field, value, err))
+		return q
+	}
+
+	q.conds = append(q.conds, queryCond{field, op, value})
+	return q
+}
+
+// Sort orders the results by field, ascending. Numbers, strings or
+// booleans, whichever the first result holding one of them has there, are
+// sorted; records lacking the field or holding anything else come last.
+// Ties keep ReadOrder.
+func (q *Query) Sort(field string) *Query {
+	q.sortField, q.desc = field, false
+	return q
+}
+
+// SortDesc is Sort, descending.
+func (q *Query) SortDesc(field string) *Query {
+	q.sortField, q.desc = field, true
+	return q
+}
+
+// Offset skips the first n results.
+func (q *Query) Offset(n int) *Query {
+	if n < 0 {
+		q.fail(fmt.Errorf("Invalid query - offset %d is negative!", n))
+	}
+	q.offset = n
+	return q
+}
+
+// Limit keeps at most n results; zero, the default, keeps them all.
+func (q *Query) Limit(n int) *Query {
+	if n < 0 {
+		q.fail(fmt.Errorf("Invalid query - limit %d is negative!", n))
+	}
+	q.limit = n
+	return q
+}
+
+func (q *Query) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// Run returns the raw contents of the records the query selects, with
+// their names.
+func (q *Query) Run() ([]KeyedRecord, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	type match struct {
+		record KeyedRecord
+		key    interface{}
+		hasKey bool
+	}
+
+	var matches []match
+	enough := q.sortField == "" && q.limit > 0
+
+	err := q.d.ForEach(q.collection, func(resource string, data []byte) error {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			return fmt.Errorf("Unable to query '%s' in '%s': %v", resource, q.collection, err)
+		}
+
+		for _, c := range q.conds {
+			if !c.holds(doc) {
+				return nil
+			}
+		}
+
+		m := match{record: KeyedRecord{resource, data}}
+		if q.sortField != "" {
+			m.key, m.hasKey = lookupField(doc, q.sortField)
+		}
+		matches = append(matches, m)
+
+		if enough && len(matches) == q.offset+q.limit {
+			return errQueryDone
+		}
+		return nil
+	})
+	if err != nil && err != errQueryDone {
+		return nil, err
+	}
+
+	if q.sortField != "" {
+		// Only values of the first sortable type seen are sorted.
+		sortType := ""
+		for i := range matches {
+			m := &matches[i]
+			if _, ok := compareJSON(m.key, m.key); m.hasKey && ok && sortType == "" {
+				sortType = typeName(m.key)
+			}
+			m.hasKey = m.hasKey && typeName(m.key) == sortType
+		}
+
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i], matches[j]
+			if !a.hasKey || !b.hasKey {
+				return a.hasKey && !b.hasKey
+			}
+
+			c, _ := compareJSON(a.key, b.key)
+			if q.desc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	records := []KeyedRecord{}
+	for i := q.offset; i < len(matches); i++ {
+		if q.limit > 0 && len(records) == q.limit {
+			break
+		}
+		records = append(records, matches[i].record)
+	}
+
+	return records, nil
+}
+
+// All decodes the records the query selects into the slice v points to,
+// appending one element per record, as Read would decode each.
+func (q *Query) All(v interface{}) error {
+	if err := checkSlicePtr(v); err != nil {
+		return err
+	}
+
+	records, err := q.Run()
+	if err != nil {
+		return err
+	}
+
+	return q.d.decodeAll(q.collection, records, v)
+}
+
+func checkSlicePtr(v interface{}) error {
+	out := reflect.ValueOf(v)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Unable to read results - expected a pointer to a slice, got %T!", v)
+	}
+	return nil
+}
+
+// decodeAll appends records, decoded as Read would decode each, to the
+// slice v points to.
+func (d *Driver) decodeAll(collection string, records []KeyedRecord, v interface{}) error {
+	results := reflect.ValueOf(v).Elem()
+
+	for _, r := range records {
+		record := reflect.New(results.Type().Elem())
+		if err := d.decode(collection, r.Resource, r.Data, record.Interface()); err != nil {
+			return err
+		}
+		results.Set(reflect.Append(results, record.Elem()))
+	}
+
+	return nil
+}
+
+// Count returns how many records the query selects.
+func (q *Query) Count() (int, error) {
+	records, err := q.Run()
+	return len(records), err
+}
+
+func (c queryCond) holds(doc interface{}) bool {
+	v, ok := lookupField(doc, c.field)
+	if !ok {
+		return c.op == "!="
+	}
+
+	switch c.op {
+	case "=":
+		return jsonEqual(v, c.value)
+	case "!=":
+		return !jsonEqual(v, c.value)
+	}
+
+	cmp, ok := compareJSON(v, c.value)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// compareJSON orders two decoded numbers, strings or booleans, reporting
+// false for other values or values of different types.
+func compareJSON(a, b interface{}) (int, bool) {
+	switch ca := a.(type) {
+	case json.Number:
+		cb, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		fa, errA := ca.Float64()
+		fb, errB := cb.Float64()
+		if errA != nil || errB != nil {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		cb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(ca, cb), true
+	case bool:
+		cb, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ca == cb:
+			return 0, true
+		case cb:
+			return -1, true
+		}
+		return 1, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,157 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+)
+
+// Pop reads a record into v and deletes it under the record's lock, so when
+// several consumers pop the same record only one of them gets it; the
+// others get ErrNotFound. A record that fails to decode into v is left in
+// place.
+func (d *Driver) Pop(collection, resource string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to pop!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to pop record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	for _, op := range []Operation{OperationRead, OperationDelete} {
+		if err := d.authorize(op, collection, resource); err != nil {
+			return err
+		}
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	return d.pop(collection, resource, v)
+}
+
+// PopAny pops the first record of collection in ReadOrder and returns its
+// name, turning the collection into a simple durable queue: with the
+// default order and names from Insert, records come out in the order they
+// were inserted, even within one millisecond, since NewULID is monotonic -
+// across processes, only to the millisecond. It fails with ErrEmpty when
+// the collection has no records or doesn't exist. The collection lock is held
+// throughout, so concurrent consumers never get the same record.
+func (d *Driver) PopAny(collection string, v interface{}) (string, error) {
+	if collection == "" {
+		return "", fmt.Errorf("Missing collection - unable to pop!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return "", err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	names, err := d.resources(collection)
+	if os.IsNotExist(err) {
+		return "", ErrEmpty
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(names) == 0 {
+		return "", ErrEmpty
+	}
+
+	resource := names[0]
+
+	for _, op := range []Operation{OperationRead, OperationDelete} {
+		if err := d.authorize(op, collection, resource); err != nil {
+			return "", err
+		}
+	}
+
+	if err := d.pop(collection, resource, v); err != nil {
+		return "", err
+	}
+
+	return resource, nil
+}
+
+// Drain reads and deletes every record of collection under the collection
+// lock, returning their raw contents keyed by resource name, so a writer
+// can't slip a record in between the read and the delete and have it lost.
+// The collection itself, with its config, stays. An empty or missing
+// collection gives an empty map. If a delete fails, Drain stops and returns
+// the records already deleted along with the error; the rest stay in
+// place.
+func (d *Driver) Drain(collection string) (map[string][]byte, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to drain!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	for _, op := range []Operation{OperationList, OperationRead, OperationDelete} {
+		if err := d.authorize(op, collection, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	drained := make(map[string][]byte)
+
+	names, err := d.resources(collection)
+	if os.IsNotExist(err) {
+		return drained, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string][]byte, len(names))
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records[name] = b
+	}
+
+	for _, name := range names {
+		b, ok := records[name]
+		if !ok {
+			continue
+		}
+
+		if err := d.delete(collection, name); err != nil {
+			return drained, err
+		}
+		drained[name] = b
+	}
+
+	return drained, nil
+}
+
+// pop reads, decodes and deletes a record; the caller must hold its lock.
+func (d *Driver) pop(collection, resource string, v interface{}) error {
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if err := d.decode(collection, resource, b, v); err != nil {
+		return err
+	}
+
+	return d.delete(collection, resource)
+}
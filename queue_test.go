@@ -0,0 +1,35 @@
+package godb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPopAnyIsFIFOWithinOneMillisecond(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db, err := New(t.TempDir(), &Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 200; i++ {
+		if _, err := db.Insert("jobs", map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 200; i++ {
+		var job map[string]int
+		if _, err := db.PopAny("jobs", &job); err != nil {
+			t.Fatal(err)
+		}
+		if job["n"] != i {
+			t.Fatalf("pop %d got job %d", i, job["n"])
+		}
+	}
+
+	var job map[string]int
+	if _, err := db.PopAny("jobs", &job); err != ErrEmpty {
+		t.Fatalf("PopAny of an empty queue = %v, want ErrEmpty", err)
+	}
+}
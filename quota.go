@@ -0,0 +1,288 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Quotas are enforced from usage counts the driver keeps in memory for
+// every collection in Options.CollectionQuota. New takes them from disk,
+// statting each record file (reading the manifest of chunked ones), and a
+// namespaced driver does so the first time it writes to a collection;
+// after that writes and deletes through the driver update them as they
+// go, so a write costs one stat of the record it replaces. Operations that
+// swap records wholesale (ReplaceCollection, Rotate, RenameCollection,
+// Freeze, Thaw) make the driver recount the collection at its next write.
+// Quarantining, compacting and vacuuming aren't tracked, so the usage they
+// free is only counted again after reopening - quotas err on the side of
+// refusing. Changes by other processes aren't seen at all.
+//
+// Bytes count what is stored for each record: its file, or all its parts
+// with Options.ChunkSize or all its fields with Options.Exploded - though
+// an exploded write counts as the length of the whole record until the
+// next recount. The write rate is counted in fixed windows of
+// Quota.Interval, by Clock, and a write refused by a quota doesn't count.
+
+// Quota bounds a collection's usage; zero fields are unbounded.
+type Quota struct {
+	MaxRecords int
+	MaxBytes   int64
+
+	// MaxWrites bounds the writes in each Interval.
+	MaxWrites int
+	Interval  time.Duration
+}
+
+// Usage is a collection's usage as counted for quotas.
+type Usage struct {
+	Records int
+	Bytes   int64
+
+	// Writes counts the writes in the current quota window, since
+	// WindowStart.
+	Writes      int
+	WindowStart time.Time
+}
+
+type quotaUsage struct {
+	mu    sync.Mutex
+	usage map[string]*Usage
+}
+
+func checkQuotas(opts Options) error {
+	for collection, q := range opts.CollectionQuota {
+		if q.MaxRecords < 0 || q.MaxBytes < 0 || q.MaxWrites < 0 || q.Interval < 0 {
+			return fmt.Errorf("Invalid quota for '%s' - limits can't be negative!", collection)
+		}
+
+		if q.MaxWrites > 0 && q.Interval == 0 {
+			return fmt.Errorf("Invalid quota for '%s' - MaxWrites needs an Interval!", collection)
+		}
+	}
+
+	return nil
+}
+
+// storedSize returns the bytes stored for the record at path, and whether
+// it exists.
+func (d *Driver) storedSize(path string) (int64, bool, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if fi.IsDir() {
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return 0, false, err
+		}
+
+		var size int64
+		for _, file := range files {
+			size += file.Size()
+		}
+		return size, true, nil
+	}
+
+	if d.opts.ChunkSize > 0 {
+		m, err := readManifest(path)
+		if err != nil {
+			return 0, false, err
+		}
+		if m != nil {
+			return int64(m.Size), true, nil
+		}
+	}
+
+	return fi.Size(), true, nil
+}
+
+// countUsage takes a collection's usage from disk.
+func (d *Driver) countUsage(collection string) (*Usage, error) {
+	u := &Usage{}
+
+	files, err := d.recordFiles(collection)
+	if os.IsNotExist(err) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dir := d.collectionDir(collection)
+	for _, file := range files {
+		size, ok, err := d.storedSize(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			u.Records++
+			u.Bytes += size
+		}
+	}
+
+	return u, nil
+}
+
+// usageOf returns the tracked usage of collection, counting it first if
+// need be; the caller must hold d.quotas.mu.
+func (d *Driver) usageOf(collection string) (*Usage, error) {
+	if u, ok := d.quotas.usage[collection]; ok {
+		return u, nil
+	}
+
+	u, err := d.countUsage(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	d.quotas.usage[collection] = u
+	return u, nil
+}
+
+// loadQuotas counts the usage of every collection with a quota, for New.
+func (d *Driver) loadQuotas() error {
+	d.quotas.mu.Lock()
+	defer d.quotas.mu.Unlock()
+
+	for collection := range d.opts.CollectionQuota {
+		if err := d.io(func() error { _, err := d.usageOf(collection); return err }); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reserveQuota accounts for storing size bytes as the record at path,
+// failing with ErrQuotaExceeded if that would break the collection's
+// quota. The returned function takes the reservation back if the write
+// fails.
+func (d *Driver) reserveQuota(collection, path string, size int64) (func(), error) {
+	q, ok := d.opts.CollectionQuota[collection]
+	if !ok {
+		return func() {}, nil
+	}
+
+	var old int64
+	var exists bool
+	err := d.io(func() (err error) {
+		old, exists, err = d.storedSize(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if d.opts.WriteStrategy == Append {
+		size += old
+	}
+
+	d.quotas.mu.Lock()
+	defer d.quotas.mu.Unlock()
+
+	var u *Usage
+	if err := d.io(func() (err error) { u, err = d.usageOf(collection); return err }); err != nil {
+		return nil, err
+	}
+
+	records, bytes := 0, size-old
+	if !exists {
+		records = 1
+	}
+
+	if q.MaxRecords > 0 && records > 0 && u.Records+records > q.MaxRecords {
+		return nil, fmt.Errorf("%w - '%s' holds %d records, its quota", ErrQuotaExceeded, collection, u.Records)
+	}
+
+	if q.MaxBytes > 0 && bytes > 0 && u.Bytes+bytes > q.MaxBytes {
+		return nil, fmt.Errorf("%w - '%s' would hold %d bytes, over its quota of %d", ErrQuotaExceeded, collection, u.Bytes+bytes, q.MaxBytes)
+	}
+
+	if q.MaxWrites > 0 {
+		if now := d.opts.Clock(); now.Sub(u.WindowStart) >= q.Interval {
+			u.WindowStart, u.Writes = now, 0
+		}
+
+		if u.Writes >= q.MaxWrites {
+			return nil, fmt.Errorf("%w - '%s' had %d writes since %s, its quota", ErrQuotaExceeded, collection, u.Writes, u.WindowStart.Format(time.RFC3339))
+		}
+	}
+
+	u.Records += records
+	u.Bytes += bytes
+	u.Writes++
+
+	return func() {
+		d.quotas.mu.Lock()
+		defer d.quotas.mu.Unlock()
+
+		u.Records -= records
+		u.Bytes -= bytes
+	}, nil
+}
+
+// releaseQuota accounts for deleting a record of size bytes.
+func (d *Driver) releaseQuota(collection string, size int64) {
+	d.quotas.mu.Lock()
+	defer d.quotas.mu.Unlock()
+
+	if u, ok := d.quotas.usage[collection]; ok {
+		u.Records--
+		u.Bytes -= size
+	}
+}
+
+// forgetUsage makes the driver recount collection at its next write.
+func (d *Driver) forgetUsage(collection string) {
+	if len(d.opts.CollectionQuota) == 0 {
+		return
+	}
+
+	d.quotas.mu.Lock()
+	defer d.quotas.mu.Unlock()
+
+	delete(d.quotas.usage, collection)
+}
+
+// CollectionUsage returns collection's usage as counted for quotas. For a
+// collection without a quota it is counted from disk, without writes.
+func (d *Driver) CollectionUsage(collection string) (Usage, error) {
+	if collection == "" {
+		return Usage{}, fmt.Errorf("Missing collection - unable to count usage!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return Usage{}, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return Usage{}, err
+	}
+
+	if _, ok := d.opts.CollectionQuota[collection]; !ok {
+		var u *Usage
+		err := d.io(func() (err error) { u, err = d.countUsage(collection); return err })
+		if err != nil {
+			return Usage{}, err
+		}
+		return *u, nil
+	}
+
+	d.quotas.mu.Lock()
+	defer d.quotas.mu.Unlock()
+
+	var u *Usage
+	if err := d.io(func() (err error) { u, err = d.usageOf(collection); return err }); err != nil {
+		return Usage{}, err
+	}
+
+	return *u, nil
+}
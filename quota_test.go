@@ -0,0 +1,36 @@
+package godb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFreezeAndThawFullCollection(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{CollectionQuota: map[string]Quota{"users": {MaxRecords: 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := db.Write("users", name, map[string]string{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Write("users", "d", map[string]string{"name": "d"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Write over the quota = %v, want ErrQuotaExceeded", err)
+	}
+
+	if err := db.Freeze("users"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Thaw("users"); err != nil {
+		t.Fatalf("Thaw of a full collection = %v", err)
+	}
+
+	if err := db.Write("users", "a", map[string]string{"name": "A"}); err != nil {
+		t.Fatalf("overwrite after Thaw = %v", err)
+	}
+	if u, err := db.CollectionUsage("users"); err != nil || u.Records != 3 {
+		t.Fatalf("CollectionUsage after Thaw = %+v, %v, want 3 records", u, err)
+	}
+}
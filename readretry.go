@@ -0,0 +1,59 @@
+package godb
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Within one process the collection lock keeps readers off a record being
+// written, but a writer in another process takes no lock this process
+// sees: with Options.RetryTornReads a record that exists yet reads back
+// empty, truncated (not valid JSON, or failing to decrypt) or with a chunk
+// missing is read again up to tornReadRetries times, waiting
+// tornReadBackoff and then twice as long each time, before the result is
+// returned as it stands. That covers renames that aren't atomic to
+// readers on some network and FUSE file systems, and writers using the
+// InPlace strategy, as long as they finish within the few milliseconds of
+// retries. It mitigates those races rather than eliminating them: a slower
+// writer is still seen mid-write, and a write that leaves the file valid
+// but stale can't be told apart. A record that is really corrupt costs the
+// full backoff on every read.
+
+const (
+	tornReadRetries = 3
+	tornReadBackoff = time.Millisecond
+)
+
+// tornReadSleep waits out a backoff; tests replace it.
+var tornReadSleep = time.Sleep
+
+// readFile reads the record file at path and returns its current version,
+// decrypted, retrying torn reads as described at the top of readretry.go.
+func (d *Driver) readFile(collection, resource, path string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		b, err := d.readStored(path)
+		if err == nil {
+			b, err = d.open(collection, resource, b)
+		}
+		if err == nil {
+			b = d.currentVersion(b)
+		}
+
+		if !d.opts.RetryTornReads || attempt == tornReadRetries || !d.torn(b, err) {
+			return b, err
+		}
+
+		tornReadSleep(tornReadBackoff << attempt)
+	}
+}
+
+// torn reports whether a read of an existing record may have overlapped a
+// write.
+func (d *Driver) torn(b []byte, err error) bool {
+	if err != nil {
+		return errors.Is(err, ErrDecrypt) || errors.Is(err, ErrCorruptRecord)
+	}
+
+	return len(b) == 0 || d.jsonRecords() && !json.Valid(b)
+}
@@ -0,0 +1,98 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stubTornReadSleep replaces the retry backoff with fn for the test.
+func stubTornReadSleep(t *testing.T, fn func(time.Duration)) {
+	saved := tornReadSleep
+	tornReadSleep = fn
+	t.Cleanup(func() { tornReadSleep = saved })
+}
+
+func TestRetryTornReads(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{RetryTornReads: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "users", "kamo.json")
+	whole, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process is half way through rewriting the record, and is
+	// done by the second retry.
+	if err := os.WriteFile(path, whole[:len(whole)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	var waits []time.Duration
+	stubTornReadSleep(t, func(d time.Duration) {
+		waits = append(waits, d)
+		if len(waits) == 2 {
+			if err := os.WriteFile(path, whole, 0644); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	var user map[string]string
+	if err := db.Read("users", "kamo", &user); err != nil {
+		t.Fatalf("Read of a record repaired while retrying: %v", err)
+	}
+	if user["name"] != "Kamo" {
+		t.Fatalf("Read = %v", user)
+	}
+	if len(waits) != 2 || waits[0] != tornReadBackoff || waits[1] != 2*tornReadBackoff {
+		t.Fatalf("backoffs = %v, want %v then twice as long", waits, tornReadBackoff)
+	}
+}
+
+func TestRetryTornReadsGivesUp(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{RetryTornReads: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users", "kamo.json"), []byte(`{"name":"Ka`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	retries := 0
+	stubTornReadSleep(t, func(time.Duration) { retries++ })
+
+	var user map[string]string
+	if err := db.Read("users", "kamo", &user); err == nil {
+		t.Fatal("Read of a record that stays torn succeeded")
+	}
+	if retries != tornReadRetries {
+		t.Fatalf("retried %d times, want %d", retries, tornReadRetries)
+	}
+
+	// Without the option the first read is final.
+	db, err = New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retries = 0
+	if err := db.Read("users", "kamo", &user); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read without RetryTornReads = %v, want a decode error", err)
+	}
+	if retries != 0 {
+		t.Fatalf("retried %d times without RetryTornReads", retries)
+	}
+}
@@ -0,0 +1,60 @@
+package godb
+
+// loadCall is a loader invocation in progress for ReadOrLoad.
+type loadCall struct {
+	done chan struct{}
+	err  error
+}
+
+// ReadOrLoad reads a record into v like Read; if the record doesn't exist it
+// calls loader, writes the value it returns and reads that into v instead -
+// the cache-aside pattern for a database fronting a slower source. Concurrent
+// misses for the same record share a single loader call, and a loader error
+// is returned to all of them without writing anything.
+func (d *Driver) ReadOrLoad(collection, resource string, v interface{}, loader func() (interface{}, error)) error {
+	err := d.Read(collection, resource, v)
+	if err != ErrNotFound {
+		return err
+	}
+
+	key := d.recordKey(collection, resource)
+
+	d.mutex.Lock()
+	call, ok := d.loads[key]
+	if !ok {
+		call = &loadCall{done: make(chan struct{})}
+		d.loads[key] = call
+	}
+	d.mutex.Unlock()
+
+	if ok {
+		<-call.done
+		if call.err != nil {
+			return call.err
+		}
+		return d.Read(collection, resource, v)
+	}
+
+	call.err = d.load(collection, resource, loader)
+
+	d.mutex.Lock()
+	delete(d.loads, key)
+	d.mutex.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return call.err
+	}
+
+	return d.Read(collection, resource, v)
+}
+
+func (d *Driver) load(collection, resource string, loader func() (interface{}, error)) error {
+	value, err := loader()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.WriteIfAbsent(collection, resource, value)
+	return err
+}
@@ -0,0 +1,84 @@
+package godb
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+)
+
+// RecordInfo names a record and the last modification time of its file.
+type RecordInfo struct {
+	Resource string
+	ModTime  time.Time
+}
+
+// RecentResources returns up to limit records of collection, most recently
+// modified first, ties broken by name (see Options.KeyComparator), without reading their contents: only
+// the directory listing is consulted, and only the newest limit entries are
+// kept while scanning it.
+func (d *Driver) RecentResources(collection string, limit int) ([]RecordInfo, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return []RecordInfo{}, nil
+	}
+
+	files, err := d.snapshotFiles(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &oldestFirst{compare: d.keyComparator(collection)}
+	for _, file := range files {
+		info := RecordInfo{d.resourceName(file.Name()), file.ModTime()}
+
+		if h.Len() < limit {
+			heap.Push(h, info)
+		} else if h.newer(info, h.infos[0]) {
+			h.infos[0] = info
+			heap.Fix(h, 0)
+		}
+	}
+
+	recent := make([]RecordInfo, h.Len())
+	for i := len(recent) - 1; i >= 0; i-- {
+		recent[i] = heap.Pop(h).(RecordInfo)
+	}
+
+	return recent, nil
+}
+
+// oldestFirst is a min-heap of records by recency, so the least recent of
+// the kept records is at the top, ready to be replaced.
+type oldestFirst struct {
+	infos   []RecordInfo
+	compare func(a, b string) int
+}
+
+func (h *oldestFirst) newer(a, b RecordInfo) bool {
+	if !a.ModTime.Equal(b.ModTime) {
+		return a.ModTime.After(b.ModTime)
+	}
+	return h.compare(a.Resource, b.Resource) < 0
+}
+
+func (h *oldestFirst) Len() int           { return len(h.infos) }
+func (h *oldestFirst) Less(i, j int) bool { return h.newer(h.infos[j], h.infos[i]) }
+func (h *oldestFirst) Swap(i, j int)      { h.infos[i], h.infos[j] = h.infos[j], h.infos[i] }
+func (h *oldestFirst) Push(x interface{}) { h.infos = append(h.infos, x.(RecordInfo)) }
+
+func (h *oldestFirst) Pop() interface{} {
+	x := h.infos[len(h.infos)-1]
+	h.infos = h.infos[:len(h.infos)-1]
+	return x
+}
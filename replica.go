@@ -0,0 +1,65 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Read replicas are plain database directories that an outside process,
+// rsync or a filesystem replication job, keeps in step with the primary.
+// The driver never writes to them.
+//
+// The read preference is primary first: Read and ReadAll only turn to the
+// replicas, in the order of Options.ReadReplicas, when the primary has no
+// such record or collection, or when reading it fails with ErrTimeout under
+// Options.OperationTimeout. The first replica that answers wins; if none
+// does, the primary's error is returned. Replica hits bypass the cache and
+// are reported exactly like primary ones, so a lagging replica can serve
+// stale data or resurrect a record just deleted from the primary. Callers
+// that can't tolerate that should use ReadFresh, which only consults the
+// primary.
+
+// newReplicas opens a read-only driver per replica directory. Replicas share
+// the primary's options, minus everything that writes or would return data
+// the primary didn't vet.
+func newReplicas(opts Options) []*Driver {
+	if len(opts.ReadReplicas) == 0 {
+		return nil
+	}
+
+	dirs := opts.ReadReplicas
+
+	opts.ReadReplicas = nil
+	opts.Authorize = nil
+	opts.CacheSize = 0
+	opts.OnConflict = nil
+	opts.QuarantineCorrupt = false
+	opts.TraceOps = false
+
+	replicas := make([]*Driver, len(dirs))
+	for i, dir := range dirs {
+		replicas[i] = newDriver(filepath.Clean(dir), opts)
+	}
+
+	return replicas
+}
+
+// replicable reports whether a failed primary read may be retried on the
+// replicas.
+func replicable(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrCollectionNotFound) || errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrTimeout)
+}
+
+// readReplica reads a record from the first replica holding it, or returns
+// err, the primary's error, if none does.
+func (d *Driver) readReplica(collection, resource string, err error) ([]byte, error) {
+	for _, replica := range d.replicas {
+		b, rerr := replica.readRecord(collection, resource)
+		if !replicable(rerr) {
+			return b, rerr
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,67 @@
+package godb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// LockResource takes the lock Write would take for resource - its own lock
+// with Options.ResourceLocks, otherwise the collection's - and returns the
+// function releasing it, so a read, some computation and a write can run as
+// one critical section. Calling unlock more than once is harmless.
+//
+// While holding the lock, write with WriteLocked and DeleteLocked: Write,
+// Delete and every other method that locks resource would wait for the
+// lock the caller holds, and deadlock. Read and the other read methods
+// take no lock and are safe to call, unless Options.QuarantineCorrupt is
+// set: quarantining a corrupt record takes its lock.
+func (d *Driver) LockResource(collection, resource string) (func(), error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to lock!")
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("Missing resource - unable to lock record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	release := d.lockResource(collection, resource)
+
+	return func() { once.Do(release) }, nil
+}
+
+// WriteLocked is Write for a caller holding resource's lock from
+// LockResource; it takes no lock itself.
+func (d *Driver) WriteLocked(collection, resource string, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	return d.write(collection, resource, v)
+}
+
+// DeleteLocked is Delete of a single record for a caller holding its lock
+// from LockResource; it takes no lock itself.
+func (d *Driver) DeleteLocked(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to delete!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to delete record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationDelete, collection, resource); err != nil {
+		return err
+	}
+
+	return d.delete(collection, resource)
+}
@@ -0,0 +1,55 @@
+package godb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestResourceLocksAreDropped(t *testing.T) {
+	db, err := New(t.TempDir(), &Options{ResourceLocks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				// Half the writes share a record, half don't.
+				resource := fmt.Sprintf("item%d-%d", i, j)
+				if j%2 == 0 {
+					resource = "shared"
+				}
+				if err := db.Write("items", resource, map[string]int{"n": j}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	unlock, err := db.LockResource("items", "held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.mutex.Lock()
+	held := len(db.resourceMutexes)
+	db.mutex.Unlock()
+	unlock()
+	unlock()
+
+	db.mutex.Lock()
+	left := len(db.resourceMutexes)
+	db.mutex.Unlock()
+
+	if held != 1 {
+		t.Errorf("%d record locks while one is held, want 1", held)
+	}
+	if left != 0 {
+		t.Errorf("%d record locks left after every lock was released", left)
+	}
+}
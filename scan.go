@@ -0,0 +1,771 @@
+package godb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReadOrder selects the order in which ReadAll and the other collection
+// scans visit records.
+type ReadOrder int
+
+const (
+	// ReadByName visits records in order of resource name, as given by
+	// Options.KeyComparator.
+	ReadByName ReadOrder = iota
+
+	// ReadByModTime visits records oldest-modified first, ties broken by
+	// name.
+	ReadByModTime
+)
+
+// sortFiles puts files in the order given by Options.ReadOrder.
+func (d *Driver) sortFiles(collection string, files []os.FileInfo) {
+	compare := d.keyComparator(collection)
+
+	sort.Slice(files, func(i, j int) bool {
+		if d.opts.ReadOrder == ReadByModTime && !files[i].ModTime().Equal(files[j].ModTime()) {
+			return files[i].ModTime().Before(files[j].ModTime())
+		}
+		return compare(d.resourceName(files[i].Name()), d.resourceName(files[j].Name())) < 0
+	})
+}
+
+// keyComparator returns the order of collection's resource names.
+func (d *Driver) keyComparator(collection string) func(a, b string) int {
+	if compare, ok := d.opts.KeyComparators[collection]; ok && compare != nil {
+		return compare
+	}
+
+	if d.opts.KeyComparator != nil {
+		return d.opts.KeyComparator
+	}
+
+	return strings.Compare
+}
+
+// NaturalKeyOrder is a KeyComparator comparing runs of digits by their
+// numeric value and everything else byte-wise, so "item2" sorts before
+// "item10". Numbers that are equal but for leading zeros fall back to
+// byte-wise order.
+func NaturalKeyOrder(a, b string) int {
+	for a != "" && b != "" {
+		da, db := digitRun(a), digitRun(b)
+
+		if da == 0 || db == 0 {
+			if a[0] != b[0] {
+				if a[0] < b[0] {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		na, nb := strings.TrimLeft(a[:da], "0"), strings.TrimLeft(b[:db], "0")
+		if len(na) != len(nb) {
+			if len(na) < len(nb) {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(na, nb); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a[:da], b[:db]); c != 0 {
+			return c
+		}
+
+		a, b = a[da:], b[db:]
+	}
+
+	return strings.Compare(a, b)
+}
+
+// digitRun returns the length of the run of ASCII digits starting s.
+func digitRun(s string) int {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// recordFiles lists the record files of a collection, in ReadOrder. Only
+// regular "<name>.json" files, or the Codec's extension, count as records,
+// plus record directories with Options.Exploded; hidden files and "*.tmp"
+// files left by an interrupted Write are skipped. Symlinks count as what
+// they point to, and broken ones are skipped.
+func (d *Driver) recordFiles(collection string) ([]os.FileInfo, error) {
+	dir := d.collectionDir(collection)
+
+	var files []os.FileInfo
+	err := d.io(func() (err error) {
+		files, err = ioutil.ReadDir(dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := files[:0]
+
+	for _, file := range followLinks(dir, files) {
+		name := file.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if file.IsDir() && !d.opts.Exploded || !file.IsDir() && !strings.HasSuffix(name, d.ext()) {
+			continue
+		}
+
+		records = append(records, file)
+	}
+
+	d.sortFiles(collection, records)
+	return records, nil
+}
+
+// followLinks replaces the symlinks among a directory's entries with what
+// they point to, still under the link's name, so a link to a record file
+// lists as that file. Broken links are dropped.
+func followLinks(dir string, files []os.FileInfo) []os.FileInfo {
+	followed := files[:0]
+
+	for _, file := range files {
+		if file.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(filepath.Join(dir, file.Name()))
+			if err != nil {
+				continue
+			}
+			file = target
+		}
+		followed = append(followed, file)
+	}
+
+	return followed
+}
+
+// resources lists the record names in a collection in ReadOrder.
+func (d *Driver) resources(collection string) ([]string, error) {
+	files, err := d.recordFiles(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = d.resourceName(file.Name())
+	}
+
+	return names, nil
+}
+
+// snapshot lists a collection's record names under a brief read lock.
+// Iterators read the records afterwards without holding the lock, skipping
+// any deleted in the meantime; records added after the snapshot are not
+// visited.
+func (d *Driver) snapshot(collection string) ([]string, error) {
+	unlock := d.rlockCollection(collection)
+	defer unlock()
+
+	return d.resources(collection)
+}
+
+// snapshotFiles is snapshot for callers that need file metadata too.
+func (d *Driver) snapshotFiles(collection string) ([]os.FileInfo, error) {
+	unlock := d.rlockCollection(collection)
+	defer unlock()
+
+	return d.recordFiles(collection)
+}
+
+// collections lists the collection directories of the database, sorted.
+func (d *Driver) collections() ([]string, error) {
+	var files []os.FileInfo
+	err := d.io(func() (err error) {
+		files, err = ioutil.ReadDir(d.dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
+			names = append(names, d.decodeKey(file.Name()))
+		}
+	}
+
+	return names, nil
+}
+
+// CollectionsMatch lists the collections whose names match pattern, in the
+// syntax of filepath.Match, sorted. No match gives an empty slice.
+func (d *Driver) CollectionsMatch(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	collections, err := d.collections()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []string{}
+	for _, collection := range collections {
+		if ok, _ := filepath.Match(pattern, collection); ok {
+			matches = append(matches, collection)
+		}
+	}
+
+	return matches, nil
+}
+
+func (d *Driver) readRecord(collection, resource string) ([]byte, error) {
+	if b, ok := d.cache.get(collection, resource); ok {
+		return b, nil
+	}
+
+	gen := d.cache.generation()
+
+	if d.opts.OnConflict != nil {
+		d.noteVersion(collection, resource)
+	}
+
+	var b []byte
+	err := d.io(func() (err error) {
+		b, err = d.loadRecord(collection, resource)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.fill(collection, resource, b, gen)
+	return b, nil
+}
+
+// ReadPrefix returns the raw contents of every record in collection whose
+// resource name starts with prefix, keyed by resource name.
+func (d *Driver) ReadPrefix(collection, prefix string) (map[string][]byte, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string][]byte)
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records[name] = b
+	}
+
+	return records, nil
+}
+
+// ForEach calls fn with the raw contents of every record in collection, in
+// ReadOrder, reading one record at a time so memory use stays constant
+// regardless of collection size. It stops at and returns the first error
+// returned by fn.
+//
+// ForEach tolerates concurrent writes: it iterates over the records that
+// existed when it started (see snapshot), skips records deleted before it
+// reaches them, and never visits records added after it started. fn may
+// call the driver's write methods.
+func (d *Driver) ForEach(collection string, fn func(resource string, data []byte) error) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(name, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errBudgetSpent stops ReadAllWithinBudget's ForEach.
+var errBudgetSpent = errors.New("budget spent")
+
+// ReadAllWithinBudget returns the raw contents of the records of
+// collection, in ReadOrder, for as long as their total length stays within
+// maxBytes: at the first record that would take it over, it stops and
+// reports truncated. Lengths are those of the records as read, after
+// decryption and the read pipeline, so they are what the result holds in
+// memory; the record that doesn't fit has been read too, so the peak is
+// maxBytes plus one record. The order makes the cut predictable for an
+// unchanged collection.
+func (d *Driver) ReadAllWithinBudget(collection string, maxBytes int64) (records [][]byte, truncated bool, err error) {
+	records = [][]byte{}
+
+	var total int64
+	err = d.ForEach(collection, func(resource string, data []byte) error {
+		if total+int64(len(data)) > maxBytes {
+			return errBudgetSpent
+		}
+
+		total += int64(len(data))
+		records = append(records, data)
+		return nil
+	})
+	if err == errBudgetSpent {
+		return records, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return records, false, nil
+}
+
+// RecordResult is one item of a Stream: a record's name and raw contents,
+// or the error that ended the stream.
+type RecordResult struct {
+	Resource string
+	Data     []byte
+	Err      error
+}
+
+// Stream sends every record of collection on the returned channel, in
+// ReadOrder, from a background goroutine that closes the channel when done.
+// It has ForEach's semantics for concurrent writes. A read error is sent as
+// a final result carrying Err. Cancel ctx to stop early; the goroutine then
+// exits without sending anything further, so an abandoned stream doesn't
+// leak it.
+func (d *Driver) Stream(ctx context.Context, collection string) (<-chan RecordResult, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan RecordResult)
+
+	go func() {
+		defer close(results)
+
+		for _, name := range names {
+			b, err := d.readRecord(collection, name)
+			if err == ErrNotFound {
+				continue
+			}
+
+			result := RecordResult{Resource: name, Data: b, Err: err}
+
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+// ReadAllRawMap returns every record in collection as undecoded JSON keyed
+// by resource name, for collections mixing record shapes: inspect a
+// discriminator field first, then unmarshal each record into its own type.
+func (d *Driver) ReadAllRawMap(collection string) (map[string]json.RawMessage, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([][]byte, len(names))
+	err = d.parallel(len(names), func(i int) (err error) {
+		contents[i], err = d.readRecord(collection, names[i])
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]json.RawMessage, len(names))
+	for i, name := range names {
+		if contents[i] != nil {
+			records[name] = json.RawMessage(contents[i])
+		}
+	}
+
+	return records, nil
+}
+
+// DeleteWhere deletes every record in collection for which match returns
+// true and reports how many were deleted. The collection lock is held for
+// the whole scan, so no concurrent write can slip in between a record being
+// matched and deleted.
+func (d *Driver) DeleteWhere(collection string, match func(resource string, data []byte) (bool, error)) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - nothing to delete!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	if err := d.authorize(OperationDelete, collection, ""); err != nil {
+		return 0, err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	names, err := d.resources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	for _, name := range names {
+		b, err := d.readRecord(collection, name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		ok, err := match(name, b)
+		if err != nil {
+			return deleted, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := d.delete(collection, name); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// ReadLatest decodes the most recently modified record of collection into v
+// and returns its resource name. Modification times come from the file
+// system, so no record other than the newest is read. An empty collection
+// returns ErrNotFound.
+func (d *Driver) ReadLatest(collection string, v interface{}) (string, error) {
+	if collection == "" {
+		return "", fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return "", err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return "", err
+	}
+
+	files, err := d.recordFiles(collection)
+	if err != nil {
+		return "", err
+	}
+
+	var latest os.FileInfo
+	for _, file := range files {
+		if latest == nil || file.ModTime().After(latest.ModTime()) {
+			latest = file
+		}
+	}
+
+	if latest == nil {
+		return "", ErrNotFound
+	}
+
+	resource := d.resourceName(latest.Name())
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return "", err
+	}
+
+	return resource, d.decode(collection, resource, b, v)
+}
+
+// CountWhere counts the records of collection for which match returns true,
+// streaming through them like ForEach without keeping any in memory. It
+// stops at the first error returned by match.
+func (d *Driver) CountWhere(collection string, match func(data []byte) (bool, error)) (int, error) {
+	count := 0
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		ok, err := match(data)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// ReadModifiedSince returns the records of collection whose files were
+// modified after since, keyed by resource name, so an incremental consumer
+// can fetch only what changed since its last poll. Deletions are not
+// reported.
+func (d *Driver) ReadModifiedSince(collection string, since time.Time) (map[string][]byte, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	files, err := d.snapshotFiles(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string][]byte)
+
+	for _, file := range files {
+		if !file.ModTime().After(since) {
+			continue
+		}
+
+		resource := d.resourceName(file.Name())
+
+		b, err := d.readRecord(collection, resource)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records[resource] = b
+	}
+
+	return records, nil
+}
+
+// checksum identifies a record's content: the hex SHA-256 of its raw bytes.
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// FindDuplicates groups the records of collection by checksum, returning
+// only the checksums shared by more than one record, each with its records'
+// names in ReadOrder. Records are streamed as in ForEach; only the
+// checksums are held in memory. Content is compared byte for byte, so
+// records differing only in formatting aren't reported - Canonicalize the
+// collection first to catch those.
+func (d *Driver) FindDuplicates(collection string) (map[string][]string, error) {
+	groups := make(map[string][]string)
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		sum := checksum(data)
+		groups[sum] = append(groups[sum], resource)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for sum, resources := range groups {
+		if len(resources) < 2 {
+			delete(groups, sum)
+		}
+	}
+
+	return groups, nil
+}
+
+// Prewarm reads every record file of collection and discards the contents,
+// pulling the files into the operating system's page cache so that reads
+// soon after startup don't pay for disk seeks. It never modifies anything
+// and stops with ctx's error once ctx is done.
+func (d *Driver) Prewarm(ctx context.Context, collection string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return err
+	}
+
+	names, err := d.snapshot(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := d.io(func() error {
+			_, err := d.loadRecord(collection, name)
+			return err
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Project returns, for every record of collection in ReadOrder, a map
+// holding only the named fields; a dotted name such as "address.city"
+// selects a nested field and is used as is as the key. Fields a record
+// doesn't have are left out of its map. Numbers come back as json.Number.
+// Records are streamed as in ForEach, so only the projections are held in
+// memory.
+func (d *Driver) Project(collection string, fields []string) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			return fmt.Errorf("Unable to project '%s': %v", resource, err)
+		}
+
+		row := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if v, ok := lookupField(doc, field); ok {
+				row[field] = v
+			}
+		}
+
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// lookupField follows a dotted path of object keys through doc.
+func lookupField(doc interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if doc, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
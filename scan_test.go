@@ -0,0 +1,126 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadOrderIsDeterministic(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []struct {
+		name string
+		mod  time.Duration
+	}{
+		{"c", time.Second},
+		{"a", 3 * time.Second},
+		{"d", 2 * time.Second},
+		{"b", time.Second}, // ties with c
+	}
+
+	for _, tc := range []struct {
+		order ReadOrder
+		want  []string
+	}{
+		{ReadByName, []string{"a", "b", "c", "d"}},
+		{ReadByModTime, []string{"b", "c", "d", "a"}},
+	} {
+		dir := t.TempDir()
+		db, err := New(dir, &Options{ReadOrder: tc.order})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range records {
+			if err := db.Write("items", r.name, map[string]string{"name": r.name}); err != nil {
+				t.Fatal(err)
+			}
+			mod := base.Add(r.mod)
+			if err := os.Chtimes(filepath.Join(dir, "items", r.name+".json"), mod, mod); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i := 0; i < 5; i++ {
+			var all []map[string]string
+			if err := db.ReadAll("items", &all); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, r := range all {
+				got = append(got, r["name"])
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ReadOrder %d: ReadAll visited %v, want %v", tc.order, got, tc.want)
+			}
+
+			got = []string{}
+			err := db.ForEach("items", func(resource string, data []byte) error {
+				got = append(got, resource)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ReadOrder %d: ForEach visited %v, want %v", tc.order, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestSymlinkedRecords(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	outside := filepath.Join(t.TempDir(), "ellen.json")
+	if err := os.WriteFile(outside, []byte(`{"name":"Ellen"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "users", "ellen.json")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing.json"), filepath.Join(dir, "users", "broken.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, "users", "folder.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = db.ForEach("users", func(resource string, data []byte) error {
+		got = append(got, resource)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEach with broken and directory symlinks: %v", err)
+	}
+	if want := []string{"ellen", "kamo"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ForEach visited %v, want %v", got, want)
+	}
+
+	var all []map[string]string
+	if err := db.ReadAll("users", &all); err != nil {
+		t.Fatalf("ReadAll with broken and directory symlinks: %v", err)
+	}
+	if len(all) != 2 || all[0]["name"] != "Ellen" || all[1]["name"] != "Kamo" {
+		t.Fatalf("ReadAll = %v, want Ellen and Kamo", all)
+	}
+
+	byName, err := db.ReadAllRawMap("users")
+	if err != nil {
+		t.Fatalf("ReadAllRawMap with broken and directory symlinks: %v", err)
+	}
+	if _, ok := byName["folder"]; ok || len(byName) != 2 {
+		t.Fatalf("ReadAllRawMap = %s, want ellen and kamo", byName)
+	}
+}
@@ -0,0 +1,219 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes the shape of a collection's records with a subset of
+// JSON Schema, and serializes as such: Type is one of "object", "array",
+// "string", "number", "integer", "boolean" or "null", or empty for any;
+// Required and Properties constrain an object's fields, Items an array's
+// elements, and Enum limits a value to a fixed set. Fields without a
+// Properties entry are allowed. Attach one to a collection through
+// CollectionConfig.
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+}
+
+// ValidationError is one way a record fails its collection's schema. Path
+// locates the offending value, e.g. "address.city" or "tags[2]", and is
+// empty for the record itself.
+type ValidationError struct {
+	Resource string
+	Path     string
+	Message  string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", e.Resource, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Resource, e.Path, e.Message)
+}
+
+// check validates a record about to be written, failing with
+// ErrSchemaViolation listing every violation.
+func (s *Schema) check(resource string, b []byte) error {
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return err
+	}
+
+	var violations []ValidationError
+	s.validate(resource, "", doc, &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		msgs[i] = v.Error()
+	}
+
+	return fmt.Errorf("%w: %s", ErrSchemaViolation, strings.Join(msgs, "; "))
+}
+
+func (s *Schema) validate(resource, path string, v interface{}, out *[]ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		*out = append(*out, ValidationError{resource, path, fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		fail("expected %s, got %s", s.Type, typeName(v))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			if want, err := decodeDocument(b); err == nil && jsonEqual(v, want) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			fail("value is not one of the allowed values")
+		}
+	}
+
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for _, field := range s.Required {
+			if _, ok := c[field]; !ok {
+				*out = append(*out, ValidationError{resource, joinPath(path, field), "required field is missing"})
+			}
+		}
+
+		fields := make([]string, 0, len(s.Properties))
+		for field := range s.Properties {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			if fv, ok := c[field]; ok && s.Properties[field] != nil {
+				s.Properties[field].validate(resource, joinPath(path, field), fv, out)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, e := range c {
+				s.Items.validate(resource, fmt.Sprintf("%s[%d]", path, i), e, out)
+			}
+		}
+	}
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func hasType(v interface{}, want string) bool {
+	if want == "integer" {
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == float64(int64(f))
+	}
+
+	return typeName(v) == want
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// ValidateCollection checks every record of collection against the
+// collection's schema and reports all violations, in ReadOrder, including
+// records that aren't valid JSON. Records are streamed as in ForEach, and a
+// bad record doesn't stop the scan. It fails if the collection has no
+// schema.
+func (d *Driver) ValidateCollection(collection string) ([]ValidationError, error) {
+	cfg, err := d.CollectionConfig(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Schema == nil {
+		return nil, fmt.Errorf("Missing schema - collection '%s' has none to validate against!", collection)
+	}
+
+	violations := []ValidationError{}
+
+	err = d.ForEach(collection, func(resource string, data []byte) error {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			violations = append(violations, ValidationError{resource, "", fmt.Sprintf("invalid JSON: %v", err)})
+			return nil
+		}
+
+		cfg.Schema.validate(resource, "", doc, &violations)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// applyDefaults adds every field of defaults that an object record lacks.
+func applyDefaults(b []byte, defaults map[string]interface{}) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return b, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	added := false
+	for field, v := range defaults {
+		if _, ok := fields[field]; ok {
+			continue
+		}
+
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		fields[field] = raw
+		added = true
+	}
+
+	if !added {
+		return b, nil
+	}
+
+	return json.Marshal(fields)
+}
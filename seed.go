@@ -0,0 +1,69 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	seedFile     = ".seeded"
+	seedLockFile = ".seeded.lock"
+)
+
+// seedPoll is how often Seed retries the lock while another process seeds.
+const seedPoll = 50 * time.Millisecond
+
+// Seed runs seed once for the database directory, to fill a new database
+// with default records, and records its success in a ".seeded" marker at
+// the database root; later calls, from any process, find the marker and
+// return at once without running seed. If seed fails, nothing is recorded
+// and the next call runs it again, so make it safe to rerun - say, by
+// writing with WriteIfAbsent.
+//
+// Concurrent starts are serialized with the same kind of lock as
+// Options.ExclusiveLock, on ".seeded.lock": callers wait while another
+// driver or process seeds, then see its marker. Like ExclusiveLock, it
+// isn't supported on every platform, and a crash after seed but before the
+// marker is written means seed runs again.
+func (d *Driver) Seed(seed func(d *Driver) error) error {
+	marker := filepath.Join(d.dir, seedFile)
+
+	if seeded, err := fileExists(marker); err != nil || seeded {
+		return err
+	}
+
+	d.seedMu.Lock()
+	defer d.seedMu.Unlock()
+
+	release, err := lockPath(filepath.Join(d.dir, seedLockFile))
+	for err == ErrLocked {
+		time.Sleep(seedPoll)
+		release, err = lockPath(filepath.Join(d.dir, seedLockFile))
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if seeded, err := fileExists(marker); err != nil || seeded {
+		return err
+	}
+
+	d.logKV(LevelInfo, "seeding database", "op", "seed", "dir", d.dir)
+
+	if err := seed(d); err != nil {
+		return fmt.Errorf("Unable to seed '%s' - %w", d.dir, err)
+	}
+
+	return d.syncFileAtomic(marker, []byte(d.opts.Clock().UTC().Format(time.RFC3339)+"\n"))
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
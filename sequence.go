@@ -0,0 +1,115 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const sequenceFile = ".sequence"
+
+// ReserveIDs advances collection's sequence by n and returns the first of
+// the n reserved IDs, so the caller can name records start to start+n-1
+// (e.g. with strconv.FormatInt) without going back to the driver for each
+// one. The first ID ever reserved is 1. The sequence is a hidden
+// ".sequence" file at the root of the collection, synced to disk before
+// ReserveIDs returns, so IDs handed out are never handed out again after a
+// crash; IDs reserved but never written are simply skipped.
+func (d *Driver) ReserveIDs(collection string, n int) (int64, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - unable to reserve IDs!")
+	}
+
+	if n < 1 {
+		return 0, fmt.Errorf("Unable to reserve %d IDs in '%s' - count must be positive!", n, collection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	if err := d.authorize(OperationWrite, collection, ""); err != nil {
+		return 0, err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	path := filepath.Join(d.collectionDir(collection), sequenceFile)
+
+	var last int64
+
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return 0, err
+	default:
+		if last, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return 0, fmt.Errorf("Invalid sequence in '%s': %v", collection, err)
+		}
+	}
+
+	if last > math.MaxInt64-int64(n) {
+		return 0, fmt.Errorf("Unable to reserve %d IDs in '%s' - sequence exhausted!", n, collection)
+	}
+
+	if err := d.io(func() error {
+		return d.syncFileAtomic(path, []byte(strconv.FormatInt(last+int64(n), 10)+"\n"))
+	}); err != nil {
+		return 0, err
+	}
+
+	return last + 1, nil
+}
+
+// syncFileAtomic is writeFileAtomic with the data and the rename flushed to
+// disk before it returns.
+func (d *Driver) syncFileAtomic(path string, b []byte) error {
+	tmpPath := path + ".tmp"
+	dir := filepath.Dir(path)
+
+	if err := d.mkdirAll(dir); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	d.countTemp()
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	d.countWrite(len(b))
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	d.countSync()
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	d.countRename()
+
+	if f, err := os.Open(dir); err == nil {
+		if f.Sync() == nil {
+			d.countSync()
+		}
+		f.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A Snapshot is a point-in-time copy of a collection made of hard links:
+// creating one links every record file into a hidden directory under the
+// database root, which takes the collection lock only as long as the
+// linking does. Writers replace a record by renaming a new file over the
+// old one, so the snapshot's link keeps the old content, and a deleted
+// record lives on in the snapshot until it is closed. The snapshot only
+// costs disk space for records rewritten or deleted since it was taken.
+//
+// This needs a file system with hard links. Where linking fails, and under
+// the InPlace and Append write strategies, which change record files in
+// place, records are copied instead, holding the lock for longer.
+
+// Snapshot holds the records a collection had when Driver.Snapshot was
+// called. It is safe for concurrent use, and must be closed to release
+// its files.
+type Snapshot struct {
+	collection string
+	dir        string
+	d          *Driver
+}
+
+// Snapshot takes a snapshot of collection. It fails with
+// ErrCollectionNotFound if the collection doesn't exist.
+func (d *Driver) Snapshot(collection string) (*Snapshot, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - nothing to snapshot!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir(d.dir, ".snapshot-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := d.opts
+	opts.Authorize = nil
+	opts.ReadReplicas = nil
+	opts.MirrorDir = ""
+	opts.CacheSize = 0
+	opts.QuarantineCorrupt = false
+	opts.EventBatchWindow = 0
+	opts.LockStats = false
+
+	s := &Snapshot{collection: collection, dir: dir, d: newDriver(dir, opts)}
+
+	unlock := d.lockCollection(collection)
+	err = d.io(func() error {
+		return d.linkTree(d.collectionDir(collection), s.d.collectionDir(collection), d.opts.WriteStrategy != AtomicRename)
+	})
+	unlock()
+
+	if err != nil {
+		os.RemoveAll(dir)
+		if os.IsNotExist(err) {
+			return nil, &ioError{ErrCollectionNotFound, err}
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Read reads a record of the snapshot into v, like Driver.Read.
+func (s *Snapshot) Read(resource string, v interface{}) error {
+	return s.d.Read(s.collection, resource, v)
+}
+
+// ReadAll reads every record of the snapshot into v, a pointer to a slice,
+// like Driver.ReadAll.
+func (s *Snapshot) ReadAll(v interface{}) error {
+	return s.d.ReadAll(s.collection, v)
+}
+
+// Close removes the snapshot's files. The snapshot can't be read after.
+func (s *Snapshot) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// linkTree recreates the directory src at dst, hard linking each file, or
+// copying it if copy is set or linking fails. Hidden files other than the
+// collection config and record chunks, such as leases and temp files, are
+// left out.
+func (d *Driver) linkTree(src, dst string, copy bool) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	if err := d.mkdirAll(dst); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, ".") && name != configFile && name != chunkDir {
+			continue
+		}
+
+		from, to := filepath.Join(src, name), filepath.Join(dst, name)
+
+		if file.IsDir() {
+			if err := d.linkTree(from, to, copy); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !copy && os.Link(from, to) == nil {
+			continue
+		}
+
+		if err := copyFile(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,160 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Staged records wait in a hidden ".staging" directory inside their
+// collection's directory, encoded and encrypted as a Write would store
+// them, so Read, ReadAll and every listing skip them until Commit. Commit
+// then writes the staged record the way Write does - to a temp file
+// renamed into place, under the record's lock, with events, the cache and
+// the mirror updated - and only then drops it from staging. Staged records
+// are lost with their collection, including when ReplaceCollection swaps
+// its directory out.
+
+const stagingDir = ".staging"
+
+func (d *Driver) stagedPath(collection, resource string) string {
+	return filepath.Join(d.collectionDir(collection), stagingDir, d.encodeResource(resource)+d.ext())
+}
+
+// Stage encodes v as Write would, checking it against the collection's
+// schema, and keeps it as a draft of resource in collection until Commit
+// or DiscardStaged. Staging the same record again replaces the draft; the
+// live record, if any, is untouched.
+func (d *Driver) Stage(collection, resource string, v interface{}) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	b, err := d.encode(collection, resource, v)
+	if err != nil {
+		return err
+	}
+
+	stored, err := d.seal(collection, resource, b)
+	if err != nil {
+		return err
+	}
+
+	path := d.stagedPath(collection, resource)
+
+	return d.io(func() error {
+		if err := d.mkdirAll(filepath.Dir(path)); err != nil {
+			return err
+		}
+		return d.writeFileAtomic(path, stored)
+	})
+}
+
+// ListStaged returns the names of the records staged in collection, in key
+// order (see Options.KeyComparator). None staged gives an empty slice.
+func (d *Driver) ListStaged(collection string) ([]string, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to list staged records!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, collection, ""); err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+	err := d.io(func() (err error) {
+		files, err = ioutil.ReadDir(filepath.Join(d.collectionDir(collection), stagingDir))
+		return err
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), d.ext()) {
+			names = append(names, d.resourceName(file.Name()))
+		}
+	}
+
+	compare := d.keyComparator(collection)
+	sort.Slice(names, func(i, j int) bool { return compare(names[i], names[j]) < 0 })
+
+	return names, nil
+}
+
+// Commit publishes the staged draft of resource in collection, replacing
+// the live record atomically as described at the top of staging.go. It
+// fails with ErrNotFound if nothing is staged for the record.
+func (d *Driver) Commit(collection, resource string) error {
+	if err := d.checkWrite(collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	path := d.stagedPath(collection, resource)
+
+	var b []byte
+	err := d.io(func() (err error) {
+		b, err = ioutil.ReadFile(path)
+		return err
+	})
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Unable to commit '%s' in '%s' - nothing staged: %w", resource, collection, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if b, err = d.open(collection, resource, b); err != nil {
+		return err
+	}
+
+	if _, err := d.writeEncoded(collection, resource, b); err != nil {
+		return err
+	}
+
+	return d.io(func() error { return os.Remove(path) })
+}
+
+// DiscardStaged drops the staged draft of resource in collection, failing
+// with ErrNotFound if there is none.
+func (d *Driver) DiscardStaged(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to discard staged record!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to discard staged record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationDelete, collection, resource); err != nil {
+		return err
+	}
+
+	unlock := d.lockResource(collection, resource)
+	defer unlock()
+
+	err := d.io(func() error { return os.Remove(d.stagedPath(collection, resource)) })
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Unable to discard '%s' in '%s' - nothing staged: %w", resource, collection, ErrNotFound)
+	}
+
+	return err
+}
@@ -0,0 +1,175 @@
+package godb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Anomaly is something in the database directory that the driver didn't
+// put there, as found by CheckStructure.
+type Anomaly struct {
+	// Path is relative to the database directory.
+	Path    string
+	Problem string
+
+	// Severe anomalies suggest the directory isn't a database at all.
+	Severe bool
+}
+
+func (a Anomaly) String() string {
+	return a.Path + ": " + a.Problem
+}
+
+// CheckStructure scans the whole database directory for entries that don't
+// look like they belong to a database: files at the top level, where only
+// collection directories, frozen collections, the operations log and
+// hidden files belong (the severe kind, as in a home directory); files in
+// a collection that aren't records or logs; record files that don't hold
+// a whole record; and directories nested in a collection that also holds
+// records. A directory holding no records is taken for a namespace, see
+// Namespace, and the directories in it are checked as collections in
+// turn, except with Options.Exploded, where directories are records.
+// Hidden entries are skipped. It reads every record, so it costs a full
+// scan; see Options.ValidateOnOpen.
+func (d *Driver) CheckStructure() ([]Anomaly, error) {
+	var entries []os.FileInfo
+	err := d.io(func() (err error) {
+		entries, err = ioutil.ReadDir(d.dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var anomalies []Anomaly
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if !entry.IsDir() {
+			if !strings.HasSuffix(name, ".frozen") && name != opsLogFile {
+				anomalies = append(anomalies, Anomaly{name, "file outside any collection", true})
+			}
+			continue
+		}
+
+		found, err := d.checkCollectionDir(name)
+		if err != nil {
+			return anomalies, err
+		}
+		anomalies = append(anomalies, found...)
+	}
+
+	return anomalies, nil
+}
+
+func (d *Driver) checkCollectionDir(rel string) ([]Anomaly, error) {
+	var files []os.FileInfo
+	err := d.io(func() (err error) {
+		files, err = ioutil.ReadDir(filepath.Join(d.dir, rel))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var anomalies, dirs, others []Anomaly
+	records := false
+
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(rel, name)
+
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if file.IsDir() {
+			if !d.opts.Exploded {
+				dirs = append(dirs, Anomaly{path, "directory nested in a collection", false})
+			}
+			continue
+		}
+
+		if strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+
+		if !strings.HasSuffix(name, d.ext()) {
+			others = append(others, Anomaly{path, "file is not a record", false})
+			continue
+		}
+
+		records = true
+
+		if !d.jsonRecords() {
+			continue
+		}
+
+		var b []byte
+		err := d.io(func() (err error) {
+			b, err = ioutil.ReadFile(filepath.Join(d.dir, path))
+			return err
+		})
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !wholeRecord(d.currentVersion(b)) {
+			anomalies = append(anomalies, Anomaly{path, "record is not valid JSON", false})
+		}
+	}
+
+	if records || d.opts.Exploded {
+		return append(append(anomalies, others...), dirs...), nil
+	}
+
+	// A directory without records is a namespace, which holds its own
+	// frozen collections and operations log, or an empty collection.
+	for _, a := range others {
+		if name := filepath.Base(a.Path); !strings.HasSuffix(name, ".frozen") && name != opsLogFile {
+			anomalies = append(anomalies, a)
+		}
+	}
+
+	for _, dir := range dirs {
+		found, err := d.checkCollectionDir(dir.Path)
+		if err != nil {
+			return anomalies, err
+		}
+		anomalies = append(anomalies, found...)
+	}
+
+	return anomalies, nil
+}
+
+// validateOnOpen runs CheckStructure for Options.ValidateOnOpen.
+func (d *Driver) validateOnOpen() error {
+	anomalies, err := d.CheckStructure()
+	if err != nil {
+		return err
+	}
+
+	var severe []string
+	for _, a := range anomalies {
+		d.logKV(LevelWarn, "unexpected entry in database directory", "op", "open", "path", a.Path, "problem", a.Problem)
+		if a.Severe {
+			severe = append(severe, a.Path)
+		}
+	}
+
+	if len(severe) > 0 {
+		return fmt.Errorf("%w - '%s' holds %d files outside any collection, such as '%s'", ErrNotDatabase, d.dir, len(severe), severe[0])
+	}
+
+	return nil
+}
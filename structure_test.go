@@ -0,0 +1,80 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReopenWithTraceOpsAndValidateOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	opts := &Options{TraceOps: true, ValidateOnOpen: true}
+
+	db, err := New(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "kamo", map[string]string{"name": "Kamo"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, opsLogFile)); err != nil {
+		t.Fatalf("no ops log after a traced write: %v", err)
+	}
+	db.Close()
+
+	db, err = New(dir, opts)
+	if err != nil {
+		t.Fatalf("reopening a traced database: %v", err)
+	}
+	defer db.Close()
+
+	anomalies, err := db.CheckStructure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anomalies) != 0 {
+		t.Fatalf("CheckStructure = %v, want no anomalies", anomalies)
+	}
+}
+
+func TestCheckStructureLooksInsideNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{TraceOps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acme, err := db.Namespace("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"users", "orders"} {
+		if err := acme.Write(c, "kamo", map[string]string{"name": "Kamo"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := acme.Freeze("orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "acme", "users", "torn.json"), []byte(`{"name":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "acme", "users", "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	anomalies, err := db.CheckStructure()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Anomaly{
+		{filepath.Join("acme", "users", "torn.json"), "record is not valid JSON", false},
+		{filepath.Join("acme", "users", "notes.txt"), "file is not a record", false},
+	}
+	if !reflect.DeepEqual(anomalies, want) {
+		t.Fatalf("CheckStructure = %v, want %v", anomalies, want)
+	}
+}
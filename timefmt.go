@@ -0,0 +1,96 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeFormat selects how a Time is stored.
+type TimeFormat int
+
+const (
+	// TimeRFC3339 stores an RFC 3339 string with nanoseconds, as
+	// time.Time itself does.
+	TimeRFC3339 TimeFormat = iota
+
+	// TimeEpochMillis stores milliseconds since the Unix epoch.
+	TimeEpochMillis
+
+	// TimeEpochSeconds stores seconds since the Unix epoch.
+	TimeEpochSeconds
+)
+
+// Time is a time.Time for record fields whose stored format matters, e.g.
+// when exchanging files with systems expecting epoch millis:
+//
+//	type Event struct {
+//		Name string
+//		At   Time
+//	}
+//
+//	db.Write("events", "boot", Event{"boot", Time{time.Now(), TimeEpochMillis}})
+//
+// stores "At" as a number. The zero Time is stored as null. When read back,
+// a string is parsed as RFC 3339 and a number as epoch millis - or epoch
+// seconds if Format is preset to TimeEpochSeconds on the value being
+// decoded into - and Format is set to match, so rewriting a record keeps its
+// format.
+type Time struct {
+	time.Time
+	Format TimeFormat
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+
+	switch t.Format {
+	case TimeEpochMillis:
+		return []byte(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)), nil
+	case TimeEpochSeconds:
+		return []byte(strconv.FormatInt(t.Unix(), 10)), nil
+	default:
+		return json.Marshal(t.Time.Format(time.RFC3339Nano))
+	}
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+
+	if bytes.Equal(b, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+
+		t.Time, t.Format = parsed, TimeRFC3339
+		return nil
+	}
+
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Unable to decode time %s - expected a string or an integer!", b)
+	}
+
+	if t.Format == TimeEpochSeconds {
+		t.Time = time.Unix(n, 0)
+		return nil
+	}
+
+	t.Time, t.Format = time.Unix(0, n*int64(time.Millisecond)), TimeEpochMillis
+	return nil
+}
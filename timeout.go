@@ -0,0 +1,43 @@
+package godb
+
+import "time"
+
+// io runs a disk operation, giving up with ErrTimeout once
+// Options.OperationTimeout elapses. Go can't interrupt a blocked syscall, so
+// on timeout the goroutine running fn is abandoned and leaks until the
+// syscall returns; the operation may also still complete after ErrTimeout
+// was reported, so a timed-out write must be treated as "unknown outcome".
+//
+// Each operation also holds one of Options.MaxOpenFiles slots while it runs,
+// waiting for a free one first; the wait counts towards the timeout.
+//
+// Errors are passed through classifyIOError.
+func (d *Driver) io(fn func() error) error {
+	if d.fileSlots != nil {
+		op := fn
+		fn = func() error {
+			d.fileSlots <- struct{}{}
+			defer func() { <-d.fileSlots }()
+			return op()
+		}
+	}
+
+	if d.opts.OperationTimeout <= 0 {
+		return classifyIOError(fn())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(d.opts.OperationTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return classifyIOError(err)
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
@@ -0,0 +1,66 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+const (
+	createdAtKey = "createdAt"
+	updatedAtKey = "updatedAt"
+)
+
+// stamp adds "createdAt" and "updatedAt" keys to a marshaled record.
+//
+// The record is decoded into a map of raw values, so this works the same for
+// maps and structs: "updatedAt" is always set to the current time, while
+// "createdAt" keeps the value already stored on disk, then any non-zero
+// value carried by v, and only falls back to the current time on the first
+// write. Values that don't marshal to a JSON object are left untouched.
+//
+// Limitations: the re-encoded object has its keys sorted, so struct field
+// order is not preserved in the file; and a struct only sees the timestamps
+// on Read if it declares fields tagged `json:"createdAt"` and
+// `json:"updatedAt"` (a string or time.Time works).
+func (d *Driver) stamp(collection, resource string, b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return b, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	now, err := json.Marshal(d.opts.Clock().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+
+	created := json.RawMessage(now)
+	if !isZeroStamp(fields[createdAtKey]) {
+		created = fields[createdAtKey]
+	}
+
+	if existing, err := d.readRecord(collection, resource); err == nil {
+		var stored map[string]json.RawMessage
+		if json.Unmarshal(existing, &stored) == nil && !isZeroStamp(stored[createdAtKey]) {
+			created = stored[createdAtKey]
+		}
+	}
+
+	fields[createdAtKey] = created
+	fields[updatedAtKey] = now
+
+	return json.MarshalIndent(fields, "", "\t")
+}
+
+func isZeroStamp(v json.RawMessage) bool {
+	switch string(bytes.TrimSpace(v)) {
+	case "", "null", `""`, `"0001-01-01T00:00:00Z"`:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadTree returns the raw contents of every record of rootCollection and
+// of the collections nested inside its directory, keyed by the record's
+// path below rootCollection: "<resource>" for its own records and
+// "<sub>/<resource>", "<sub>/<subsub>/<resource>" and so on for nested
+// ones, slash-delimited on every platform. Hidden files and directories,
+// and temp files, are skipped throughout.
+//
+// Collections only nest when Options.KeyValidator lets collection names
+// contain "/" (e.g. "tenants/acme/users"); with DefaultKeyValidator
+// ReadTree returns rootCollection's own records. It doesn't support
+// Options.Exploded, where a directory is a record.
+func (d *Driver) ReadTree(rootCollection string) (map[string][]byte, error) {
+	if rootCollection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read!")
+	}
+
+	if d.opts.Exploded {
+		return nil, fmt.Errorf("Unable to read tree '%s' - exploded records are directories!", rootCollection)
+	}
+
+	if err := d.validateNames(rootCollection); err != nil {
+		return nil, err
+	}
+
+	if err := d.authorize(OperationList, rootCollection, ""); err != nil {
+		return nil, err
+	}
+
+	root := d.collectionDir(rootCollection)
+
+	if _, err := os.Stat(root); err != nil {
+		if os.IsNotExist(err) {
+			return nil, &ioError{ErrCollectionNotFound, err}
+		}
+		return nil, err
+	}
+
+	records := make(map[string][]byte)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if path != root && strings.HasPrefix(name, ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() || !strings.HasSuffix(name, d.ext()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		collection := rootCollection
+		key := ""
+		if rel != "." {
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			for i, part := range parts {
+				parts[i] = d.decodeKey(part)
+			}
+			collection += "/" + strings.Join(parts, "/")
+			key = strings.Join(parts, "/") + "/"
+		}
+
+		resource := d.resourceName(name)
+
+		var b []byte
+		err = d.io(func() (err error) {
+			b, err = d.readStored(path)
+			return err
+		})
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if b, err = d.open(collection, resource, b); err != nil {
+			return err
+		}
+
+		records[key+resource] = d.unwrap(d.currentVersion(b))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,71 @@
+package godb
+
+import "context"
+
+// StreamItem is one item of a StreamTyped: a record's name and decoded
+// value, or the error that ended the stream.
+type StreamItem[T any] struct {
+	Resource string
+	Value    T
+	Err      error
+}
+
+// StreamTyped is Stream decoding every record into a T, as Read would. A
+// record that fails to decode, like a read error or an invalid collection
+// name, is sent as a final item carrying Err. Call the returned func to
+// stop early; the producing goroutines then exit and the channel is
+// closed, so an abandoned stream doesn't leak them. Calling it after the
+// stream is drained is harmless.
+func StreamTyped[T any](d *Driver, collection string) (<-chan StreamItem[T], func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	items := make(chan StreamItem[T])
+
+	records, err := d.Stream(ctx, collection)
+
+	go func() {
+		defer close(items)
+		defer cancel()
+
+		send := func(item StreamItem[T]) bool {
+			select {
+			case items <- item:
+				return item.Err == nil
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if err != nil {
+			send(StreamItem[T]{Err: err})
+			return
+		}
+
+		for record := range records {
+			item := StreamItem[T]{Resource: record.Resource, Err: record.Err}
+			if item.Err == nil {
+				item.Err = d.decode(collection, record.Resource, record.Data, &item.Value)
+			}
+
+			if !send(item) {
+				return
+			}
+		}
+	}()
+
+	return items, cancel
+}
+
+// ReadAllTyped is ReadAll decoding into a []T, for callers who'd rather
+// name the type than declare the slice:
+//
+//	orders, err := godb.ReadAllTyped[Order](db, "orders")
+//
+// An existing collection without records gives an empty, non-nil slice.
+func ReadAllTyped[T any](d *Driver, collection string) ([]T, error) {
+	var records []T
+	if err := d.ReadAll(collection, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
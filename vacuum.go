@@ -0,0 +1,186 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VacuumOptions selects what Vacuum prunes. The zero value prunes nothing;
+// each setting enables one kind of pruning on its own.
+type VacuumOptions struct {
+	// KeepVersions, if positive, trims every record file written with the
+	// Append strategy to its last KeepVersions versions.
+	KeepVersions int
+
+	// ExpiredLeases, if positive, removes lease files whose lease expired
+	// more than ExpiredLeases ago.
+	ExpiredLeases time.Duration
+
+	// Quarantine, if positive, removes the collection's quarantined
+	// records whose files were last modified more than Quarantine ago.
+	Quarantine time.Duration
+}
+
+// Vacuum reclaims the space collection spends on data no read will return
+// again, as selected by opts, and reports how many bytes it freed. It runs
+// under the collection lock. Every file is trimmed by an atomic rewrite or
+// removed outright, so an interrupted Vacuum leaves each file either as it
+// was or vacuumed, and simply running it again finishes the job.
+func (d *Driver) Vacuum(collection string, opts VacuumOptions) (int64, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("Missing collection - nothing to vacuum!")
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	unlock := d.lockCollection(collection)
+	defer unlock()
+
+	var reclaimed int64
+
+	if opts.KeepVersions > 0 && d.opts.WriteStrategy == Append {
+		n, err := d.vacuumVersions(collection, opts.KeepVersions)
+		reclaimed += n
+		if err != nil {
+			return reclaimed, err
+		}
+	}
+
+	if opts.ExpiredLeases > 0 {
+		n, err := d.vacuumLeases(collection, opts.ExpiredLeases)
+		reclaimed += n
+		if err != nil {
+			return reclaimed, err
+		}
+	}
+
+	if opts.Quarantine > 0 {
+		n, err := d.vacuumQuarantine(collection, opts.Quarantine)
+		reclaimed += n
+		if err != nil {
+			return reclaimed, err
+		}
+	}
+
+	d.logKV(LevelInfo, "vacuumed collection", "op", "vacuum", "collection", collection, "reclaimed", reclaimed)
+	return reclaimed, nil
+}
+
+func (d *Driver) vacuumVersions(collection string, keep int) (int64, error) {
+	names, err := d.resources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	var reclaimed int64
+
+	for _, name := range names {
+		path := d.recordPath(collection, name)
+
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return reclaimed, err
+		}
+
+		var versions [][]byte
+		dec := json.NewDecoder(bytes.NewReader(b))
+		for {
+			var v json.RawMessage
+			if dec.Decode(&v) != nil {
+				break
+			}
+			versions = append(versions, d.terminate(v))
+		}
+
+		if len(versions) <= keep {
+			continue
+		}
+
+		trimmed := bytes.Join(versions[len(versions)-keep:], nil)
+
+		if err := d.io(func() error { return d.writeFileAtomic(path, trimmed) }); err != nil {
+			return reclaimed, err
+		}
+
+		reclaimed += int64(len(b) - len(trimmed))
+	}
+
+	return reclaimed, nil
+}
+
+func (d *Driver) vacuumLeases(collection string, age time.Duration) (int64, error) {
+	files, err := ioutil.ReadDir(d.collectionDir(collection))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := d.opts.Clock()
+
+	var reclaimed int64
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".lease") {
+			continue
+		}
+
+		resource := d.decodeKey(strings.TrimSuffix(strings.TrimPrefix(name, "."), ".lease"))
+
+		l, ok, err := d.readLease(collection, resource)
+		if err != nil || !ok || now.Sub(l.Expires) <= age {
+			continue
+		}
+
+		if err := os.Remove(d.leasePath(collection, resource)); err != nil && !os.IsNotExist(err) {
+			return reclaimed, err
+		}
+
+		reclaimed += file.Size()
+	}
+
+	return reclaimed, nil
+}
+
+func (d *Driver) vacuumQuarantine(collection string, age time.Duration) (int64, error) {
+	dir := filepath.Join(d.dir, quarantineDir, d.encodeKey(collection))
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := d.opts.Clock()
+
+	var reclaimed int64
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), d.ext()) || now.Sub(file.ModTime()) <= age {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(dir, file.Name())); err != nil {
+			return reclaimed, err
+		}
+
+		reclaimed += file.Size()
+	}
+
+	return reclaimed, nil
+}
@@ -0,0 +1,62 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// WaitFor blocks until a record exists and returns nil, or returns
+// ctx.Err() once ctx is done; use context.WithTimeout for a deadline.
+//
+// Records written through this driver are noticed at once, through
+// Subscribe. Records written by other processes are only found by polling
+// for the file every poll; a poll of zero or less disables polling, so
+// WaitFor then only sees writes made in-process.
+func (d *Driver) WaitFor(ctx context.Context, collection, resource string, poll time.Duration) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to wait!")
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to wait for record (no name)!")
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := d.authorize(OperationRead, collection, resource); err != nil {
+		return err
+	}
+
+	// Subscribe before the first check, so a write landing in between
+	// isn't missed.
+	events, cancel := d.Subscribe(collection)
+	defer cancel()
+
+	var tick <-chan time.Time
+	if poll > 0 {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		_, err := d.statRecord(collection, resource)
+		if err == nil {
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-events:
+		case <-tick:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package godb
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Walk calls fn with the raw contents of every record of every collection,
+// reading one record at a time as ForEach does, and stops at and returns
+// the first error fn returns. Collections are visited in the order of
+// their directory names, each as ForEach visits it - its records in
+// ReadOrder - followed by the collections nested inside it, depth first in
+// the same order. Collections only nest when Options.KeyValidator lets
+// names contain "/" (the nested collection "tenants/acme" is reported by
+// that name); otherwise, and with Options.Exploded, where directories are
+// records, only top-level collections are walked. Hidden files and
+// directories and temp files are skipped, and so are collections deleted
+// while the walk is under way.
+func (d *Driver) Walk(fn func(collection, resource string, data []byte) error) error {
+	collections, err := d.collections()
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		if err := d.walkCollection(collection, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) walkCollection(collection string, fn func(collection, resource string, data []byte) error) error {
+	err := d.ForEach(collection, func(resource string, data []byte) error {
+		return fn(collection, resource, data)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Subdirectories are only collections if the validator takes a name
+	// nested in this one.
+	if d.opts.Exploded || d.validateNames(collection+"/x") != nil {
+		return nil
+	}
+
+	var files []os.FileInfo
+	err = d.io(func() (err error) {
+		files, err = ioutil.ReadDir(d.collectionDir(collection))
+		return err
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, file := range followLinks(d.collectionDir(collection), files) {
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		if err := d.walkCollection(collection+"/"+d.decodeKey(file.Name()), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteStrategy selects how a record's file is updated on disk.
+type WriteStrategy int
+
+const (
+	// AtomicRename writes the record to a temp file and renames it over
+	// the old one, so readers and crashes only ever see a whole record.
+	AtomicRename WriteStrategy = iota
+
+	// InPlace truncates and rewrites the record file itself. It saves the
+	// temp file and keeps the file's inode, hard links and permissions,
+	// but a crash or a concurrent reader in another process can see a
+	// truncated record.
+	InPlace
+
+	// Append adds every write to the end of the record file, keeping the
+	// previous versions before it; reads return the last complete version,
+	// so a crash mid-write leaves the one before in force. Files only grow
+	// until Compact collapses them to their current version. Each write is
+	// cheap, but each read parses the whole history.
+	Append
+)
+
+func (s WriteStrategy) String() string {
+	switch s {
+	case AtomicRename:
+		return "atomic-rename"
+	case InPlace:
+		return "in-place"
+	case Append:
+		return "append"
+	}
+	return fmt.Sprintf("WriteStrategy(%d)", int(s))
+}
+
+// checkWriteStrategy rejects strategies the other options can't work with.
+func checkWriteStrategy(opts Options) error {
+	switch opts.WriteStrategy {
+	case AtomicRename:
+		return nil
+	case InPlace, Append:
+	default:
+		return fmt.Errorf("Invalid write strategy %v!", opts.WriteStrategy)
+	}
+
+	if opts.Exploded {
+		return fmt.Errorf("Invalid write strategy - exploded storage only supports %v!", AtomicRename)
+	}
+
+	if opts.WriteStrategy == Append && (len(opts.EncryptionKey) > 0 || len(opts.CollectionKeys) > 0) {
+		return fmt.Errorf("Invalid write strategy - encrypted records can't use %v!", Append)
+	}
+
+	return nil
+}
+
+// writeFile stores a record file's bytes using Options.WriteStrategy.
+func (d *Driver) writeFile(path string, b []byte) error {
+	switch d.opts.WriteStrategy {
+	case InPlace:
+		if err := d.mkdirAll(filepath.Dir(path)); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+		d.countWrite(len(b))
+		return nil
+	case Append:
+		if err := d.mkdirAll(filepath.Dir(path)); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			return err
+		}
+		d.countWrite(len(b))
+		return f.Close()
+	}
+
+	if err := d.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := d.writeFileAtomic(path, b); err != nil {
+		return err
+	}
+	d.countWrite(len(b))
+	d.countTemp()
+	d.countRename()
+	return nil
+}
+
+// currentVersion returns the record held by a record file's bytes: under
+// Append, the last complete JSON value; otherwise the bytes themselves.
+func (d *Driver) currentVersion(b []byte) []byte {
+	if d.opts.WriteStrategy != Append {
+		return b
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	var last json.RawMessage
+	for {
+		var v json.RawMessage
+		if dec.Decode(&v) != nil {
+			break
+		}
+		last = v
+	}
+
+	if last == nil {
+		return b
+	}
+
+	return d.terminate(last)
+}